@@ -2,12 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"propher/internal/config"
 	app "propher/propher"
 	"strings"
+	"time"
 )
 
 // Эти переменные обычно пробрасываются через -ldflags
@@ -17,10 +19,21 @@ var (
 	date    = "unknown"
 )
 
+// Коды выхода процесса.
+const (
+	exitOK           = 0
+	exitError        = 1
+	exitSLOViolation = 3
+	exitRegression   = 4
+)
+
 const (
 	modeRun                = "run"
 	modeLoadDumpAndRewrite = "load-dump-and-rewrite"
 	modeMeasureListLatency = "measure-list-latency"
+	modeCompare            = "compare"
+	modeReport             = "report"
+	modeHTMLReport         = "html-report"
 )
 
 func main() {
@@ -33,7 +46,7 @@ func realMain() int {
 	cfg, mode, err := parseConfig(os.Args[1:])
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "error:", err)
-		return 1
+		return exitError
 	}
 
 	// Диспатчим подкоманды.
@@ -41,25 +54,43 @@ func realMain() int {
 	case modeRun:
 		if err := app.RunLoadDumpAndRewrite(cfg); err != nil {
 			fmt.Fprintln(os.Stderr, "error:", err)
-			return 1
+			return exitError
 		}
 		if err := app.RunMeasureListLatency(cfg); err != nil {
 			fmt.Fprintln(os.Stderr, "error:", err)
-			return 1
+			return exitCode(err)
 		}
-		return 0
+		return exitOK
 	case modeLoadDumpAndRewrite:
 		if err := app.RunLoadDumpAndRewrite(cfg); err != nil {
 			fmt.Fprintln(os.Stderr, "error:", err)
-			return 1
+			return exitError
 		}
-		return 0
+		return exitOK
 	case modeMeasureListLatency:
 		if err := app.RunMeasureListLatency(cfg); err != nil {
 			fmt.Fprintln(os.Stderr, "error:", err)
-			return 1
+			return exitCode(err)
+		}
+		return exitOK
+	case modeCompare:
+		if err := app.RunCompare(cfg); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return exitCode(err)
 		}
-		return 0
+		return exitOK
+	case modeReport:
+		if err := app.RunReport(cfg); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return exitError
+		}
+		return exitOK
+	case modeHTMLReport:
+		if err := app.RunHTMLReport(cfg); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return exitError
+		}
+		return exitOK
 	default:
 	}
 
@@ -69,10 +100,23 @@ func realMain() int {
 
 	if err := run(ctx, cfg); err != nil {
 		fmt.Fprintln(os.Stderr, "error:", err)
-		return 1
+		return exitError
 	}
 
-	return 0
+	return exitOK
+}
+
+// exitCode сопоставляет ошибку запуска с кодом выхода.
+func exitCode(err error) int {
+	var sloErr *app.SLOViolationError
+	if errors.As(err, &sloErr) {
+		return exitSLOViolation
+	}
+	var regressionErr *app.RegressionError
+	if errors.As(err, &regressionErr) {
+		return exitRegression
+	}
+	return exitError
 }
 
 // run is placeholder
@@ -114,18 +158,64 @@ func parseConfig(args []string) (*config.Config, string, error) {
 	case modeRun:
 		bindLoadDumpFlags(fs, &cfg.LoadDump)
 		bindMeasureListLatencyFlags(fs, &cfg.MeasureListLatency)
+		bindPushFlags(fs, &cfg.Push)
 	case modeLoadDumpAndRewrite:
 		bindLoadDumpFlags(fs, &cfg.LoadDump)
+		// В режиме run эти флаги уже подключены measure и push.
+		fs.StringVar(&cfg.MeasureListLatency.MessageIDField, "message-id-field", cfg.MeasureListLatency.MessageIDField, "Field containing message id")
+		fs.StringVar(&cfg.Push.RunID, "run-id", cfg.Push.RunID, "Run ID ({run} in generated message ids; default: run start time)")
 	case modeMeasureListLatency:
 		bindMeasureListLatencyFlags(fs, &cfg.MeasureListLatency)
+		bindPushFlags(fs, &cfg.Push)
+	case modeCompare:
+		bindCompareFlags(fs, cfg)
+	case modeReport:
+		bindReportFlags(fs, cfg)
+		bindPushFlags(fs, &cfg.Push)
+	case modeHTMLReport:
+		bindHTMLReportFlags(fs, &cfg.HTMLReport)
 	}
 
-	if err := fs.Parse(rest); err != nil {
-		return nil, "", err
+	// Флаги и позиционные аргументы (файлы) могут чередоваться.
+	var positional []string
+	for {
+		if err := fs.Parse(rest); err != nil {
+			return nil, "", err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		rest = fs.Args()[1:]
+	}
+	switch mode {
+	case modeCompare:
+		cfg.Compare.Files = positional
+	case modeReport:
+		cfg.Report.Files = positional
+	case modeHTMLReport:
+		if len(positional) > 1 {
+			return nil, "", fmt.Errorf("html-report takes a single stats file")
+		}
+		if len(positional) == 1 {
+			cfg.HTMLReport.Stats = positional[0]
+		}
+	default:
+		if len(positional) > 0 {
+			return nil, "", fmt.Errorf("unexpected arguments: %s", strings.Join(positional, " "))
+		}
+	}
+
+	// Интервал меньше миллисекунды не продвигает ряд с шагом в микросекундах.
+	if cfg.SeriesInterval != 0 && cfg.SeriesInterval < time.Millisecond {
+		return nil, "", fmt.Errorf("series-interval must be 0 or at least 1ms, got %s", cfg.SeriesInterval)
 	}
 
 	// Сохраняем приоритет редис-конфигурации.
 	setFlags := collectSetFlags(fs)
+	if cfg.MeasureListLatency.TUI && !setFlags["log-records"] {
+		cfg.MeasureListLatency.LogRecords = false
+	}
 	if setFlags["redis-url"] {
 		cfg.Redis.URL = strings.TrimSpace(cfg.Redis.URL)
 	} else if setFlags["redis-addr"] || setFlags["redis-pass"] || setFlags["redis-db"] {
@@ -139,6 +229,8 @@ func bindCommonFlags(fs *flag.FlagSet, cfg *config.Config) {
 	// Общие параметры CLI.
 	fs.BoolVar(&cfg.Debug, "debug", cfg.Debug, "Enable debug logging")
 	fs.DurationVar(&cfg.Timeout, "timeout", cfg.Timeout, "Timeout duration (e.g. 5s, 1m)")
+	fs.DurationVar(&cfg.SeriesInterval, "series-interval", cfg.SeriesInterval, "Time-series row interval (0 disables time-series output)")
+	fs.StringVar(&cfg.MetricsAddr, "metrics-addr", cfg.MetricsAddr, "Serve Prometheus metrics on this address during the run (e.g. :9102; empty disables)")
 	//fs.StringVar(&cfg.QueueName, "queue", cfg.QueueName, "Queue name")
 	fs.StringVar(&cfg.Redis.URL, "redis-url", cfg.Redis.URL, "Redis URL")
 	fs.StringVar(&cfg.Redis.Addr, "redis-addr", cfg.Redis.Addr, "Redis address")
@@ -148,6 +240,7 @@ func bindCommonFlags(fs *flag.FlagSet, cfg *config.Config) {
 	fs.StringVar(&cfg.MQTT.Username, "mqtt-username", cfg.MQTT.Username, "MQTT username")
 	fs.StringVar(&cfg.MQTT.Password, "mqtt-password", cfg.MQTT.Password, "MQTT password")
 	fs.StringVar(&cfg.MQTT.ClientID, "mqtt-client-id", cfg.MQTT.ClientID, "MQTT client id")
+	fs.StringVar(&cfg.MQTT.Version, "mqtt-version", cfg.MQTT.Version, "MQTT protocol version for publishing: 3.1.1 or 5")
 }
 
 func bindLoadDumpFlags(fs *flag.FlagSet, cfg *config.LoadDumpConfig) {
@@ -155,10 +248,14 @@ func bindLoadDumpFlags(fs *flag.FlagSet, cfg *config.LoadDumpConfig) {
 	fs.StringVar(&cfg.InDump, "in-dump", cfg.InDump, "Input dump file (JSONL) (required)")
 	fs.StringVar(&cfg.OutDump, "out-dump", cfg.OutDump, "Output dump file (JSONL) (required)")
 	fs.StringVar(&cfg.SentField, "sent-field", cfg.SentField, "Field to rewrite")
-	fs.StringVar(&cfg.EpochUnit, "epoch-unit", cfg.EpochUnit, "Unit to write: ms or s")
+	fs.StringVar(&cfg.EpochUnit, "epoch-unit", cfg.EpochUnit, "Format to write: s, ms, us, ns, rfc3339, layout:<go layout> or auto (keep the field's format)")
+	fs.StringVar(&cfg.EpochTZ, "epoch-tz", cfg.EpochTZ, "Time zone for string formats: UTC, Local, offset like +03:00 or IANA name")
+	fs.Var((*stringList)(&cfg.Rewrites), "rewrite", "Another timestamp field to rewrite, repeatable: field[,format=auto|s|ms|us|ns|rfc3339|layout:...][,mode=shift|same|increment] (shift keeps its offset from -sent-field)")
+	fs.StringVar(&cfg.Mutate, "mutate", cfg.Mutate, "File with payload mutation rules, one per line: set, delete, rename, choice, seq, env")
+	fs.Uint64Var(&cfg.MutateSeed, "mutate-seed", cfg.MutateSeed, "Seed for random choice rules (0 = random, printed in the [MUTATE] line)")
 	fs.StringVar(&cfg.Mode, "mode", cfg.Mode, "Rewrite mode: same or increment")
-	fs.Int64Var(&cfg.Step, "step", cfg.Step, "Step for increment mode (in ms or s depending on epoch-unit)")
-	fs.Int64Var(&cfg.BaseEpoch, "base-epoch", cfg.BaseEpoch, "Base epoch override (0 = now)")
+	fs.Int64Var(&cfg.Step, "step", cfg.Step, "Step for increment mode (in epoch-unit; ms for string formats and auto)")
+	fs.Int64Var(&cfg.BaseEpoch, "base-epoch", cfg.BaseEpoch, "Base epoch override in the step unit (0 = now)")
 	fs.StringVar(&cfg.RedisQueue, "redis-queue", cfg.RedisQueue, "Target Redis LIST key to load into")
 	fs.StringVar(&cfg.RedisPush, "redis-push", cfg.RedisPush, "rpush or lpush")
 	fs.BoolVar(&cfg.ClearQueue, "clear-queue", cfg.ClearQueue, "DEL target queue before loading")
@@ -166,6 +263,14 @@ func bindLoadDumpFlags(fs *flag.FlagSet, cfg *config.LoadDumpConfig) {
 	fs.StringVar(&cfg.MQTTTopic, "mqtt-topic", cfg.MQTTTopic, "Target MQTT topic to publish into")
 	fs.IntVar(&cfg.MQTTQoS, "mqtt-qos", cfg.MQTTQoS, "MQTT QoS (0..2)")
 	fs.BoolVar(&cfg.MQTTRetain, "mqtt-retain", cfg.MQTTRetain, "MQTT retain flag")
+	fs.BoolVar(&cfg.Traceparent, "traceparent", cfg.Traceparent, "Generate a fresh W3C traceparent per message")
+	fs.StringVar(&cfg.TraceparentField, "traceparent-field", cfg.TraceparentField, "JSON field for the generated traceparent (always written to the out dump)")
+	fs.StringVar(&cfg.TraceparentCarrier, "traceparent-carrier", cfg.TraceparentCarrier, "Where the traceparent travels: payload, mqtt-property (MQTT v5 user property) or both")
+	fs.StringVar(&cfg.RewriteMessageID, "rewrite-message-id", cfg.RewriteMessageID, "Generate new message ids: keep, uuid4, uuid7, counter ({run}-{n}) or template")
+	fs.StringVar(&cfg.MessageIDTemplate, "message-id-template", cfg.MessageIDTemplate, "Template for -rewrite-message-id template: {run}, {n} (required), {orig}")
+	fs.StringVar(&cfg.OrigIDField, "orig-id-field", cfg.OrigIDField, "Field that keeps the original message id when new ids are generated")
+	fs.IntVar(&cfg.Repeat, "repeat", cfg.Repeat, "Stream the input dump N times (0 = once, or until -total)")
+	fs.Int64Var(&cfg.Total, "total", cfg.Total, "Stop after M messages, looping the input dump as needed (0 = no limit)")
 }
 
 func bindMeasureListLatencyFlags(fs *flag.FlagSet, cfg *config.MeasureListLatencyConfig) {
@@ -174,17 +279,112 @@ func bindMeasureListLatencyFlags(fs *flag.FlagSet, cfg *config.MeasureListLatenc
 	fs.StringVar(&cfg.HoldQueue, "hold-queue", cfg.HoldQueue, "Hold LIST key (default: <obs-queue>:hold)")
 	fs.IntVar(&cfg.DurationSec, "duration-sec", cfg.DurationSec, "How long to measure (seconds)")
 	fs.IntVar(&cfg.BlockSec, "block-sec", cfg.BlockSec, "BRPOPLPUSH timeout (seconds)")
+	fs.IntVar(&cfg.Consumers, "consumers", cfg.Consumers, "Number of concurrent BRPOPLPUSH consumers")
+	fs.BoolVar(&cfg.TUI, "tui", cfg.TUI, "Show a live terminal dashboard instead of per-record log lines")
+	fs.BoolVar(&cfg.LogRecords, "log-records", cfg.LogRecords, "Log a [RECORD] line per message (default off with -tui)")
 	fs.StringVar(&cfg.OutJSONL, "out-jsonl", cfg.OutJSONL, "Output JSONL path")
+	fs.StringVar(&cfg.Export, "export", cfg.Export, "Also write records as csv and/or parquet next to the JSONL (comma-separated)")
+	fs.StringVar(&cfg.ExportFields, "export-fields", cfg.ExportFields, "Comma-separated message fields to copy into records: name (result message) or source:name")
+	fs.StringVar(&cfg.GroupBy, "group-by", cfg.GroupBy, "Comma-separated message fields for per-group stats: name (result message) or source:name")
+	fs.IntVar(&cfg.GroupByMax, "group-by-max", cfg.GroupByMax, "Maximum number of groups; the rest are counted as __other__")
+	fs.StringVar(&cfg.SizeBuckets, "size-buckets", cfg.SizeBuckets, "Comma-separated increasing payload size bounds in bytes for per-size stats (empty disables)")
+	fs.StringVar(&cfg.SizeBucketBy, "size-bucket-by", cfg.SizeBucketBy, "Payload whose size picks the bucket: source or result")
+	fs.StringVar(&cfg.Stages, "stages", cfg.Stages, "Ordered pipeline stage timestamp fields of the result message, field[:unit] (e.g. ingest_ts:ms,enrich_ts:ms,sent_epoch:us)")
+	fs.StringVar(&cfg.TraceField, "trace-field", cfg.TraceField, "Field containing trace id or W3C traceparent")
+	fs.StringVar(&cfg.CorrelateBy, "correlate-by", cfg.CorrelateBy, "Match results to the source dump by message_id, trace (trace-field) or auto (message_id, then trace)")
+	fs.StringVar(&cfg.OTLPEndpoint, "otlp-endpoint", cfg.OTLPEndpoint, "Export each successful record as a span to this OTLP/HTTP collector, e.g. http://localhost:4318 (empty disables)")
+	fs.StringVar(&cfg.OTLPHeaders, "otlp-headers", cfg.OTLPHeaders, "Extra OTLP request headers: key=value,key2=value2")
+	fs.StringVar(&cfg.OTLPService, "otlp-service", cfg.OTLPService, "service.name of exported spans")
 	fs.StringVar(&cfg.SourceDump, "source-dump", cfg.SourceDump, "Source dump file (JSONL) to match by message_id (required)")
 	fs.StringVar(&cfg.MessageIDField, "message-id-field", cfg.MessageIDField, "Field containing message id")
 	fs.StringVar(&cfg.SourceSentField, "source-sent-field", cfg.SourceSentField, "Field containing source sent_epoch")
-	fs.StringVar(&cfg.SourceSentUnit, "source-sent-unit", cfg.SourceSentUnit, "Unit for source sent_epoch: auto, s, ms, us")
+	fs.StringVar(&cfg.SourceSentUnit, "source-sent-unit", cfg.SourceSentUnit, "Unit for source sent_epoch: auto, s, ms, us, ns or layout:<go layout>")
 	fs.StringVar(&cfg.T0Field, "t0-field", cfg.T0Field, "Field containing result sent_epoch")
-	fs.StringVar(&cfg.T0Unit, "t0-unit", cfg.T0Unit, "Unit for result sent_epoch: auto, s, ms, us")
+	fs.StringVar(&cfg.T0Unit, "t0-unit", cfg.T0Unit, "Unit for result sent_epoch: auto, s, ms, us, ns or layout:<go layout>")
+	fs.IntVar(&cfg.HistPrecision, "hist-precision", cfg.HistPrecision, "Histogram precision in significant digits (1..5)")
+	fs.StringVar(&cfg.Percentiles, "percentiles", cfg.Percentiles, "Comma-separated percentiles to report (e.g. 50,99,99.9)")
+	fs.BoolVar(&cfg.StatsHistogram, "stats-histogram", cfg.StatsHistogram, "Export histogram buckets into the stats file")
+	fs.IntVar(&cfg.WarmupSec, "warmup-sec", cfg.WarmupSec, "Exclude records read in the first N seconds from stats")
+	fs.IntVar(&cfg.CooldownSec, "cooldown-sec", cfg.CooldownSec, "Exclude records read in the last N seconds of duration-sec from stats")
+	fs.IntVar(&cfg.WarmupCount, "warmup-count", cfg.WarmupCount, "Exclude the first N source messages (by sent_epoch) from stats")
+	fs.IntVar(&cfg.CooldownCount, "cooldown-count", cfg.CooldownCount, "Exclude the last N source messages (by sent_epoch) from stats")
+	fs.StringVar(&cfg.StatsSentFrom, "stats-sent-from", cfg.StatsSentFrom, "Exclude source messages sent before this epoch or ISO time from stats")
+	fs.StringVar(&cfg.StatsSentTo, "stats-sent-to", cfg.StatsSentTo, "Exclude source messages sent after this epoch or ISO time from stats")
+	fs.BoolVar(&cfg.HTMLReport, "html-report", cfg.HTMLReport, "Write a self-contained HTML report next to the stats file")
+	fs.Var((*stringList)(&cfg.SLO), "slo", "SLO check, repeatable (e.g. serve_us.p99<=5000, ok_throughput_msg_s>=1000, lost_ratio<=0.01)")
+	fs.StringVar(&cfg.SLOFile, "slo-file", cfg.SLOFile, "File with SLO checks, one per line")
+	fs.StringVar(&cfg.JUnit, "junit", cfg.JUnit, "Write a JUnit XML report (scenario, lost messages and SLO checks as test cases)")
+	fs.Float64Var(&cfg.JUnitMaxLostRatio, "junit-max-lost-ratio", cfg.JUnitMaxLostRatio, "Allowed lost_ratio for the lost_messages test case")
 	fs.BoolVar(&cfg.Restore, "restore", cfg.Restore, "Restore messages from hold back to obs after measurement")
 	fs.BoolVar(&cfg.RestoreVerify, "restore-verify-empty", cfg.RestoreVerify, "Refuse restore if obs-queue is non-empty at restore time")
 }
 
+// stringList - повторяемый строковый флаг.
+type stringList []string
+
+func (s *stringList) String() string {
+	if s == nil {
+		return ""
+	}
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func bindCompareFlags(fs *flag.FlagSet, cfg *config.Config) {
+	// Параметры режима compare.
+	fs.Float64Var(&cfg.Compare.TolerancePct, "tolerance-pct", cfg.Compare.TolerancePct, "Allowed percentile increase / throughput decrease, percent")
+	fs.Float64Var(&cfg.Compare.LostTolerance, "lost-tolerance", cfg.Compare.LostTolerance, "Allowed absolute increase of lost_ratio")
+	fs.Float64Var(&cfg.Compare.Alpha, "alpha", cfg.Compare.Alpha, "Significance level of the distribution test")
+	fs.StringVar(&cfg.Compare.JUnit, "junit", cfg.Compare.JUnit, "Write a JUnit XML report with one test case per candidate")
+	fs.IntVar(&cfg.MeasureListLatency.HistPrecision, "hist-precision", cfg.MeasureListLatency.HistPrecision, "Histogram precision for records files (1..5)")
+	fs.StringVar(&cfg.MeasureListLatency.Percentiles, "percentiles", cfg.MeasureListLatency.Percentiles, "Comma-separated percentiles for records files")
+}
+
+func bindReportFlags(fs *flag.FlagSet, cfg *config.Config) {
+	// Параметры режима report.
+	fs.StringVar(&cfg.Report.Out, "out", cfg.Report.Out, "Output stats file (default: <first-file>.report.stats.json)")
+	fs.StringVar(&cfg.Report.From, "from", cfg.Report.From, "Only records read at or after this epoch or ISO time")
+	fs.StringVar(&cfg.Report.To, "to", cfg.Report.To, "Only records read at or before this epoch or ISO time")
+	fs.BoolVar(&cfg.Report.OKOnly, "ok-only", cfg.Report.OKOnly, "Only successful records")
+	fs.StringVar(&cfg.Report.IDPattern, "id-pattern", cfg.Report.IDPattern, "Only records whose message_id matches this regexp")
+	fs.BoolVar(&cfg.Report.IncludeExcluded, "include-excluded", cfg.Report.IncludeExcluded, "Include records excluded by warm-up/cool-down windows")
+	measureCfg := &cfg.MeasureListLatency
+	fs.IntVar(&measureCfg.HistPrecision, "hist-precision", measureCfg.HistPrecision, "Histogram precision in significant digits (1..5)")
+	fs.StringVar(&measureCfg.Percentiles, "percentiles", measureCfg.Percentiles, "Comma-separated percentiles to report")
+	fs.BoolVar(&measureCfg.StatsHistogram, "stats-histogram", measureCfg.StatsHistogram, "Export histogram buckets into the stats file")
+	fs.StringVar(&measureCfg.SourceDump, "source-dump", measureCfg.SourceDump, "Source dump file (JSONL) to compute lost messages (optional)")
+	fs.StringVar(&measureCfg.GroupBy, "group-by", measureCfg.GroupBy, "Comma-separated fields for per-group stats (columns of \"extra\" in records, e.g. type or source:type)")
+	fs.IntVar(&measureCfg.GroupByMax, "group-by-max", measureCfg.GroupByMax, "Maximum number of groups; the rest are counted as __other__")
+	fs.StringVar(&measureCfg.SizeBuckets, "size-buckets", measureCfg.SizeBuckets, "Comma-separated increasing payload size bounds in bytes for per-size stats (empty disables)")
+	fs.StringVar(&measureCfg.SizeBucketBy, "size-bucket-by", measureCfg.SizeBucketBy, "Payload whose size picks the bucket: source or result (source_bytes/result_bytes in records)")
+	fs.StringVar(&measureCfg.Stages, "stages", measureCfg.Stages, "Ordered stage names for per-hop stats from hops_us in records (units are ignored)")
+	fs.StringVar(&measureCfg.MessageIDField, "message-id-field", measureCfg.MessageIDField, "Field containing message id")
+	fs.StringVar(&measureCfg.SourceSentField, "source-sent-field", measureCfg.SourceSentField, "Field containing source sent_epoch")
+	fs.StringVar(&measureCfg.SourceSentUnit, "source-sent-unit", measureCfg.SourceSentUnit, "Unit for source sent_epoch: auto, s, ms, us, ns or layout:<go layout>")
+}
+
+func bindPushFlags(fs *flag.FlagSet, cfg *config.PushConfig) {
+	// Параметры отправки итоговой статистики.
+	fs.StringVar(&cfg.URL, "push-url", cfg.URL, "Push final stats to this Pushgateway base URL or remote-write URL (empty disables)")
+	fs.StringVar(&cfg.Format, "push-format", cfg.Format, "Push format: pushgateway, remote-write")
+	fs.StringVar(&cfg.Job, "push-job", cfg.Job, "Job name for pushed metrics")
+	fs.StringVar(&cfg.RunID, "run-id", cfg.RunID, "Run ID label (default: run start time)")
+	fs.StringVar(&cfg.GitCommit, "git-commit", cfg.GitCommit, "Git commit label")
+	fs.StringVar(&cfg.Scenario, "scenario", cfg.Scenario, "Scenario name label")
+}
+
+func bindHTMLReportFlags(fs *flag.FlagSet, cfg *config.HTMLReportConfig) {
+	// Параметры режима html-report.
+	fs.StringVar(&cfg.Stats, "stats", cfg.Stats, "Stats file (or pass it as an argument)")
+	fs.StringVar(&cfg.Series, "series", cfg.Series, "Time-series file (default: next to the stats file)")
+	fs.StringVar(&cfg.Lost, "lost", cfg.Lost, "Lost messages file")
+	fs.StringVar(&cfg.Out, "out", cfg.Out, "Output HTML file (default: <stats>.report.html)")
+}
+
 func extractMode(args []string) (string, bool, []string, error) {
 	// Разбираем режим из аргументов до обработки флагов.
 	mode := ""
@@ -221,7 +421,7 @@ func extractMode(args []string) (string, bool, []string, error) {
 func isMode(value string) bool {
 	// Проверяем, является ли значение известным режимом.
 	switch value {
-	case modeRun, modeLoadDumpAndRewrite, modeMeasureListLatency:
+	case modeRun, modeLoadDumpAndRewrite, modeMeasureListLatency, modeCompare, modeReport, modeHTMLReport:
 		return true
 	default:
 		return false
@@ -29,6 +29,8 @@ type MQTTConfig struct {
 	Password string
 	// ClientID - идентификатор клиента MQTT.
 	ClientID string
+	// Version - версия протокола: 3.1.1 или 5.
+	Version string
 }
 
 type Config struct {
@@ -36,6 +38,10 @@ type Config struct {
 	Debug bool
 	// Timeout - таймаут запросов.
 	Timeout time.Duration
+	// SeriesInterval - интервал временного ряда (0 = отключен).
+	SeriesInterval time.Duration
+	// MetricsAddr - адрес HTTP-эндпоинта Prometheus /metrics (пусто = отключен).
+	MetricsAddr string
 	// QueueName - имя очереди по умолчанию.
 	//QueueName string
 	// Redis - параметры подключения к Redis.
@@ -46,6 +52,14 @@ type Config struct {
 	LoadDump LoadDumpConfig
 	// MeasureListLatency - настройки режима measure-list-latency.
 	MeasureListLatency MeasureListLatencyConfig
+	// Compare - настройки режима compare.
+	Compare CompareConfig
+	// Report - настройки режима report.
+	Report ReportConfig
+	// HTMLReport - настройки режима html-report.
+	HTMLReport HTMLReportConfig
+	// Push - отправка итоговой статистики в Pushgateway/remote-write.
+	Push PushConfig
 }
 
 type LoadDumpConfig struct {
@@ -55,8 +69,16 @@ type LoadDumpConfig struct {
 	OutDump string
 	// SentField - имя переписываемого поля.
 	SentField string
-	// EpochUnit - единица времени: ms или s.
+	// EpochUnit - формат записи времени: s, ms, us, ns, rfc3339, layout:<раскладка Go> или auto (как в поле).
 	EpochUnit string
+	// EpochTZ - зона строковых меток: UTC, Local, смещение или имя IANA.
+	EpochTZ string
+	// Rewrites - дополнительные метки времени: field[,format=...][,mode=same|increment|shift].
+	Rewrites []string
+	// Mutate - файл правил изменения сообщений (set, delete, rename, choice, seq, env).
+	Mutate string
+	// MutateSeed - seed случайного выбора правил (0 - случайный).
+	MutateSeed uint64
 	// Mode - режим переписывания: same или increment.
 	Mode string
 	// Step - шаг инкремента времени.
@@ -77,6 +99,22 @@ type LoadDumpConfig struct {
 	MQTTQoS int
 	// MQTTRetain - retain флаг MQTT.
 	MQTTRetain bool
+	// Traceparent - генерировать W3C traceparent для каждого сообщения.
+	Traceparent bool
+	// TraceparentField - поле traceparent в сообщении и выходном дампе.
+	TraceparentField string
+	// TraceparentCarrier - куда класть traceparent: payload, mqtt-property или both.
+	TraceparentCarrier string
+	// RewriteMessageID - генерация message_id: keep, uuid4, uuid7, counter или template.
+	RewriteMessageID string
+	// MessageIDTemplate - шаблон message_id с {run}, {n}, {orig}.
+	MessageIDTemplate string
+	// OrigIDField - поле для исходного message_id при генерации новых.
+	OrigIDField string
+	// Repeat - число проходов по входному дампу (0 - один или до Total).
+	Repeat int
+	// Total - остановиться после стольких сообщений (0 - без ограничения).
+	Total int64
 }
 
 type MeasureListLatencyConfig struct {
@@ -88,6 +126,8 @@ type MeasureListLatencyConfig struct {
 	DurationSec int
 	// BlockSec - таймаут BRPOPLPUSH в секундах.
 	BlockSec int
+	// Consumers - число параллельных потребителей очереди.
+	Consumers int
 	// OutJSONL - путь к JSONL-отчету.
 	OutJSONL string
 	// SourceDump - путь к исходному JSONL дампу для сопоставления.
@@ -102,14 +142,124 @@ type MeasureListLatencyConfig struct {
 	T0Field string
 	// T0Unit - единица времени: auto, s, ms, us.
 	T0Unit string
-	// TraceField - поле trace id.
+	// HistPrecision - число значащих цифр гистограмм (1..5).
+	HistPrecision int
+	// Percentiles - список персентилей для отчета, например 50,99,99.9.
+	Percentiles string
+	// StatsHistogram - выгружать ячейки гистограмм в stats-файл.
+	StatsHistogram bool
+	// WarmupSec - исключить из статистики первые N секунд прогона.
+	WarmupSec int
+	// CooldownSec - исключить из статистики последние N секунд прогона.
+	CooldownSec int
+	// WarmupCount - исключить первые N сообщений источника по sent_epoch.
+	WarmupCount int
+	// CooldownCount - исключить последние N сообщений источника по sent_epoch.
+	CooldownCount int
+	// StatsSentFrom - нижняя граница sent_epoch источника для статистики.
+	StatsSentFrom string
+	// StatsSentTo - верхняя граница sent_epoch источника для статистики.
+	StatsSentTo string
+	// Export - дополнительные форматы записей: csv, parquet (через запятую).
+	Export string
+	// ExportFields - поля сообщений, копируемые в записи (source:field для исходного).
+	ExportFields string
+	// JUnit - путь отчета JUnit XML (пусто = не писать).
+	JUnit string
+	// JUnitMaxLostRatio - допустимая доля потерь для кейса lost_messages.
+	JUnitMaxLostRatio float64
+	// GroupBy - поля для разбивки статистики по группам (source:field для исходного).
+	GroupBy string
+	// GroupByMax - максимум групп; остальные попадают в __other__.
+	GroupByMax int
+	// SizeBuckets - границы диапазонов размера сообщения в байтах (пусто = без разбивки).
+	SizeBuckets string
+	// SizeBucketBy - чей размер раскладывать по диапазонам: source или result.
+	SizeBucketBy string
+	// Stages - упорядоченные поля меток времени сервисов конвейера (field[:unit]).
+	Stages string
+	// TUI - интерактивная панель в терминале во время измерения.
+	TUI bool
+	// LogRecords - печатать строку [RECORD] на каждое сообщение.
+	LogRecords bool
+	// HTMLReport - строить HTML-отчет после измерения.
+	HTMLReport bool
+	// SLO - пороговые выражения вида serve_us.p99<=5000.
+	SLO []string
+	// SLOFile - файл с SLO-выражениями, по одному на строку.
+	SLOFile string
+	// TraceField - поле trace id (строка или W3C traceparent).
 	TraceField string
+	// CorrelateBy - ключ сопоставления с источником: message_id, trace или auto.
+	CorrelateBy string
+	// OTLPEndpoint - адрес OTLP/HTTP коллектора для экспорта спанов (пусто = не отправлять).
+	OTLPEndpoint string
+	// OTLPHeaders - заголовки запросов к коллектору: k=v,k2=v2.
+	OTLPHeaders string
+	// OTLPService - service.name ресурса спанов.
+	OTLPService string
 	// Restore - возвращать сообщения обратно.
 	Restore bool
 	// RestoreVerify - проверять пустоту очереди перед восстановлением.
 	RestoreVerify bool
 }
 
+type CompareConfig struct {
+	// Files - stats-файлы или latency.jsonl; первый - базовый прогон.
+	Files []string
+	// TolerancePct - допустимое ухудшение персентилей и throughput, %.
+	TolerancePct float64
+	// LostTolerance - допустимый рост доли потерь (абсолютный).
+	LostTolerance float64
+	// Alpha - уровень значимости теста распределений.
+	Alpha float64
+	// JUnit - путь отчета JUnit XML (пусто = не писать).
+	JUnit string
+}
+
+type ReportConfig struct {
+	// Files - файлы latency.jsonl для пересчета.
+	Files []string
+	// Out - путь итогового stats-файла.
+	Out string
+	// From - нижняя граница времени чтения (epoch или ISO).
+	From string
+	// To - верхняя граница времени чтения (epoch или ISO).
+	To string
+	// OKOnly - учитывать только успешные записи.
+	OKOnly bool
+	// IDPattern - регулярное выражение для message_id.
+	IDPattern string
+	// IncludeExcluded - учитывать записи из окон прогрева/остывания.
+	IncludeExcluded bool
+}
+
+type HTMLReportConfig struct {
+	// Stats - путь к stats-файлу.
+	Stats string
+	// Series - путь к временному ряду (по умолчанию рядом со stats).
+	Series string
+	// Lost - путь к lost.json.
+	Lost string
+	// Out - путь HTML-файла.
+	Out string
+}
+
+type PushConfig struct {
+	// URL - адрес Pushgateway или remote-write эндпоинта (пусто = отключено).
+	URL string
+	// Format - формат отправки: pushgateway, remote-write.
+	Format string
+	// Job - имя job в группировке.
+	Job string
+	// RunID - идентификатор прогона (по умолчанию время старта).
+	RunID string
+	// GitCommit - коммит тестируемой сборки.
+	GitCommit string
+	// Scenario - имя сценария нагрузки.
+	Scenario string
+}
+
 // Load loads .env (if present) and returns app config with defaults applied.
 func Load() (*Config, error) {
 	// Загружаем .env без ошибки, если файла нет.
@@ -130,10 +280,17 @@ func Load() (*Config, error) {
 		return nil, err
 	}
 
+	seriesInterval, err := getenvDuration("SERIES_INTERVAL", time.Second)
+	if err != nil {
+		return nil, err
+	}
+
 	// Собираем конфигурацию со значениями по умолчанию.
 	return &Config{
-		Debug:   getenvBool("DEBUG", false),
-		Timeout: timeout,
+		Debug:          getenvBool("DEBUG", false),
+		Timeout:        timeout,
+		SeriesInterval: seriesInterval,
+		MetricsAddr:    getenvDefault("METRICS_ADDR", ""),
 		//QueueName: getenvDefault("QUEUE_NAME", "default"),
 		Redis: redis,
 		MQTT:  mqttCfg,
@@ -145,10 +302,18 @@ func Load() (*Config, error) {
 			RedisPush: "rpush",
 			BatchSize: 1000,
 			MQTTQoS:   0,
+
+			TraceparentField:   "traceparent",
+			TraceparentCarrier: "payload",
+
+			RewriteMessageID:  "keep",
+			MessageIDTemplate: "{run}-{n}-{orig}",
+			OrigIDField:       "orig_message_id",
 		},
 		MeasureListLatency: MeasureListLatencyConfig{
 			DurationSec:     600,
 			BlockSec:        1,
+			Consumers:       1,
 			OutJSONL:        "latency.jsonl",
 			MessageIDField:  "message_id",
 			SourceSentField: "sent_epoch",
@@ -156,6 +321,33 @@ func Load() (*Config, error) {
 			T0Field:         "sent_epoch",
 			T0Unit:          "us",
 			TraceField:      "trace_id",
+			CorrelateBy:     "message_id",
+			OTLPEndpoint:    getenvDefault("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+			OTLPHeaders:     getenvDefault("OTEL_EXPORTER_OTLP_HEADERS", ""),
+			OTLPService:     getenvDefault("OTEL_SERVICE_NAME", "propher"),
+			HistPrecision:   3,
+			Percentiles:     "50,90,95,99,99.9,99.99",
+			StatsHistogram:  true,
+			LogRecords:      true,
+			GroupByMax:      100,
+			SizeBuckets:     "1024,4096,16384,65536",
+			SizeBucketBy:    "source",
+		},
+		HTMLReport: HTMLReportConfig{
+			Lost: "lost.json",
+		},
+		Push: PushConfig{
+			URL:       getenvDefault("PUSH_URL", ""),
+			Format:    getenvDefault("PUSH_FORMAT", "pushgateway"),
+			Job:       "propher",
+			RunID:     getenvDefault("RUN_ID", ""),
+			GitCommit: getenvDefault("GIT_COMMIT", ""),
+			Scenario:  getenvDefault("SCENARIO", ""),
+		},
+		Compare: CompareConfig{
+			TolerancePct:  10,
+			LostTolerance: 0,
+			Alpha:         0.05,
 		},
 	}, nil
 }
@@ -199,6 +391,7 @@ func loadMQTTConfig() (MQTTConfig, error) {
 		Username: os.Getenv("MQTT_USERNAME"),
 		Password: os.Getenv("MQTT_PASSWORD"),
 		ClientID: os.Getenv("MQTT_CLIENT_ID"),
+		Version:  getenvDefault("MQTT_VERSION", "3.1.1"),
 	}, nil
 }
 
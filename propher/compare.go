@@ -0,0 +1,352 @@
+package propher
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"propher/internal/config"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RegressionError возвращается compare при превышении допуска регрессии.
+type RegressionError struct {
+	Regressions int
+}
+
+func (e *RegressionError) Error() string {
+	return fmt.Sprintf("regression detected: %d metrics beyond tolerance", e.Regressions)
+}
+
+// compareInput - один сравниваемый прогон.
+type compareInput struct {
+	Path  string
+	Stats measureStatsFile
+	// HasLost - известны ли потери (в latency.jsonl их нет).
+	HasLost bool
+	Serve   []weightedValue
+	Latency []weightedValue
+}
+
+// weightedValue - значение выборки с весом (ячейка гистограммы или сырое значение).
+type weightedValue struct {
+	Value  int64
+	Weight int64
+}
+
+// ksResult - результат двухвыборочного теста Колмогорова-Смирнова.
+type ksResult struct {
+	D      float64
+	PValue float64
+}
+
+// RunCompare сравнивает прогоны: первый файл - базовый, остальные - кандидаты.
+func RunCompare(cfg *config.Config) error {
+	compareCfg := cfg.Compare
+	if len(compareCfg.Files) < 2 {
+		return fmt.Errorf("compare needs at least two stats or records files")
+	}
+	if compareCfg.TolerancePct < 0 || compareCfg.LostTolerance < 0 {
+		return fmt.Errorf("tolerance values must be non-negative")
+	}
+	if compareCfg.Alpha <= 0 || compareCfg.Alpha >= 1 {
+		return fmt.Errorf("alpha must be in (0, 1)")
+	}
+	quantiles, err := parsePercentiles(cfg.MeasureListLatency.Percentiles)
+	if err != nil {
+		return fmt.Errorf("percentiles: %w", err)
+	}
+
+	inputs := make([]*compareInput, 0, len(compareCfg.Files))
+	for _, path := range compareCfg.Files {
+		in, err := loadCompareInput(path, cfg.MeasureListLatency.HistPrecision, quantiles)
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, in)
+	}
+
+	base := inputs[0]
+	regressions := 0
+	suite := junitTestSuite{Name: "compare"}
+	for _, cand := range inputs[1:] {
+		started := time.Now()
+		fmt.Printf("baseline:  %s\ncandidate: %s\n", base.Path, cand.Path)
+		regs := compareRuns(base, cand, compareCfg)
+		regressions += len(regs)
+		suite.add(compareJUnitCase(base.Path, cand.Path, regs), time.Since(started).Seconds())
+		fmt.Println()
+	}
+	if compareCfg.JUnit != "" {
+		if err := writeJUnit(compareCfg.JUnit, suite); err != nil {
+			return err
+		}
+		measureLogger.Printf("[JUNIT] path=%s tests=%d failures=%d", compareCfg.JUnit, suite.Tests, suite.Failures)
+	}
+	if regressions > 0 {
+		return &RegressionError{Regressions: regressions}
+	}
+	return nil
+}
+
+// loadCompareInput читает stats-файл или latency.jsonl.
+// Записи сводятся в гистограммы: тест KS идет по ячейкам, как для stats-файла.
+func loadCompareInput(path string, digits int, quantiles []float64) (*compareInput, error) {
+	stats, ok, err := readStatsFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return &compareInput{
+			Path:    path,
+			Stats:   stats,
+			HasLost: stats.MessagesInDump > 0,
+			Serve:   histogramSample(stats.ServeUs),
+			Latency: histogramSample(stats.LatencyUs),
+		}, nil
+	}
+
+	agg := newRecordAggregator(digits, quantiles)
+	bad, err := scanRecordsFile(path, func(rec Record) error {
+		agg.add(rec)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if bad > 0 {
+		measureLogger.Printf("[COMPARE] path=%s unparsed_lines=%d", path, bad)
+	}
+	stats = agg.stats(true)
+	return &compareInput{
+		Path:    path,
+		Stats:   stats,
+		Serve:   histogramSample(stats.ServeUs),
+		Latency: histogramSample(stats.LatencyUs),
+	}, nil
+}
+
+// readStatsFile читает stats-файл; ok=false - это latency.jsonl. Читается только первое
+// JSON-значение файла, у latency.jsonl это одна запись, а не весь файл.
+func readStatsFile(path string) (stats measureStatsFile, ok bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return stats, false, fmt.Errorf("read %s: %w", path, err)
+	}
+	defer f.Close()
+	var first json.RawMessage
+	if json.NewDecoder(f).Decode(&first) != nil || !isStatsFile(first) {
+		return stats, false, nil
+	}
+	if err := json.Unmarshal(first, &stats); err != nil {
+		return stats, false, fmt.Errorf("parse stats %s: %w", path, err)
+	}
+	return stats, true, nil
+}
+
+// isStatsFile отличает stats-файл от записи latency.jsonl по первому JSON-значению.
+func isStatsFile(raw []byte) bool {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return false
+	}
+	_, ok := probe["total_read"]
+	return ok
+}
+
+func histogramSample(d *distributionStats) []weightedValue {
+	if d == nil {
+		return nil
+	}
+	out := make([]weightedValue, 0, len(d.Histogram))
+	for _, b := range d.Histogram {
+		out = append(out, weightedValue{Value: b.ToUs, Weight: b.Count})
+	}
+	return out
+}
+
+// ksTest - двухвыборочный тест Колмогорова-Смирнова с асимптотическим p-value.
+// Выборки должны быть отсортированы по значению.
+func ksTest(a, b []weightedValue) (ksResult, bool) {
+	var na, nb int64
+	for _, v := range a {
+		na += v.Weight
+	}
+	for _, v := range b {
+		nb += v.Weight
+	}
+	if na == 0 || nb == 0 {
+		return ksResult{}, false
+	}
+	var (
+		i, j   int
+		ca, cb int64
+		d      float64
+	)
+	for i < len(a) || j < len(b) {
+		var x int64
+		switch {
+		case j >= len(b) || (i < len(a) && a[i].Value <= b[j].Value):
+			x = a[i].Value
+		default:
+			x = b[j].Value
+		}
+		for i < len(a) && a[i].Value == x {
+			ca += a[i].Weight
+			i++
+		}
+		for j < len(b) && b[j].Value == x {
+			cb += b[j].Weight
+			j++
+		}
+		d = math.Max(d, math.Abs(float64(ca)/float64(na)-float64(cb)/float64(nb)))
+	}
+	ne := float64(na) * float64(nb) / float64(na+nb)
+	sq := math.Sqrt(ne)
+	return ksResult{D: d, PValue: ksQ((sq + 0.12 + 0.11/sq) * d)}, true
+}
+
+// ksQ - функция распределения Колмогорова Q(lambda).
+func ksQ(lambda float64) float64 {
+	if lambda < 1e-6 {
+		return 1
+	}
+	sum := 0.0
+	sign := 1.0
+	for k := 1; k <= 100; k++ {
+		term := sign * math.Exp(-2*float64(k*k)*lambda*lambda)
+		sum += term
+		if math.Abs(term) < 1e-12 {
+			break
+		}
+		sign = -sign
+	}
+	return math.Min(1, math.Max(0, 2*sum))
+}
+
+// compareMetrics возвращает сравниваемые метрики обоих прогонов.
+func compareMetrics(base, cand measureStatsFile) []string {
+	metrics := []string{"ok_throughput_msg_s", "lost_ratio", "ok", "bad"}
+	for _, dist := range []string{"serve_us", "latency_us"} {
+		labels := map[string]bool{"p50": true, "p90": true, "p95": true, "p99": true}
+		for _, s := range []measureStatsFile{base, cand} {
+			var d *distributionStats
+			if dist == "serve_us" {
+				d = s.ServeUs
+			} else {
+				d = s.LatencyUs
+			}
+			if d != nil {
+				for label := range d.Percentiles {
+					labels[label] = true
+				}
+			}
+		}
+		sorted := make([]string, 0, len(labels))
+		for label := range labels {
+			sorted = append(sorted, label)
+		}
+		sortPercentileLabels(sorted)
+		for _, label := range sorted {
+			metrics = append(metrics, dist+"."+label)
+		}
+		metrics = append(metrics, dist+".mean", dist+".max")
+	}
+	return metrics
+}
+
+// compareRuns печатает дельты и возвращает описания регрессий.
+func compareRuns(base, cand *compareInput, compareCfg config.CompareConfig) []string {
+	tol := compareCfg.TolerancePct / 100
+
+	// Значимость различий распределений.
+	significant := map[string]bool{}
+	for _, dist := range []struct {
+		name string
+		a, b []weightedValue
+	}{
+		{"serve_us", base.Serve, cand.Serve},
+		{"latency_us", base.Latency, cand.Latency},
+	} {
+		res, ok := ksTest(dist.a, dist.b)
+		if !ok {
+			// Без распределений считаем различие значимым, чтобы не скрыть регрессию.
+			significant[dist.name] = true
+			fmt.Printf("[KS] %s n/a (no histogram data)\n", dist.name)
+			continue
+		}
+		significant[dist.name] = res.PValue < compareCfg.Alpha
+		fmt.Printf("[KS] %s D=%.4f p=%.4g significant=%t (alpha=%g)\n",
+			dist.name, res.D, res.PValue, significant[dist.name], compareCfg.Alpha)
+	}
+
+	metrics := compareMetrics(base.Stats, cand.Stats)
+	width := len("metric")
+	for _, m := range metrics {
+		width = max(width, len(m))
+	}
+	fmt.Printf("%-*s %14s %14s %14s %9s  %s\n", width, "metric", "baseline", "candidate", "delta", "delta%", "status")
+
+	var regressions []string
+	for _, metric := range metrics {
+		if metric == "lost_ratio" && (!base.HasLost || !cand.HasLost) {
+			fmt.Printf("%-*s %14s %14s %14s %9s  %s\n", width, metric, "n/a", "n/a", "", "", "")
+			continue
+		}
+		bv, bok := lookupStatsMetric(base.Stats, metric)
+		cv, cok := lookupStatsMetric(cand.Stats, metric)
+		if !bok || !cok {
+			fmt.Printf("%-*s %14s %14s %14s %9s  %s\n", width, metric, formatCompareValue(bv, bok), formatCompareValue(cv, cok), "", "", "")
+			continue
+		}
+		delta := cv - bv
+		pct := "n/a"
+		if bv != 0 {
+			pct = strconv.FormatFloat(delta/bv*100, 'f', 2, 64) + "%"
+		}
+
+		status := "ok"
+		dist, stat, _ := strings.Cut(metric, ".")
+		switch {
+		case metric == "ok_throughput_msg_s":
+			if cv < bv*(1-tol) {
+				status = "REGRESSION"
+			}
+		case metric == "lost_ratio":
+			if delta > compareCfg.LostTolerance {
+				status = "REGRESSION"
+			}
+		case (dist == "serve_us" || dist == "latency_us") && stat != "max":
+			if cv > bv*(1+tol) {
+				if significant[dist] {
+					status = "REGRESSION"
+				} else {
+					status = "worse (not significant)"
+				}
+			}
+		default:
+			status = ""
+		}
+		if status == "REGRESSION" {
+			regressions = append(regressions, fmt.Sprintf("%s: baseline=%s candidate=%s delta=%s (%s)",
+				metric, formatCompareValue(bv, true), formatCompareValue(cv, true), formatCompareValue(delta, true), pct))
+		}
+		fmt.Printf("%-*s %14s %14s %14s %9s  %s\n", width, metric,
+			formatCompareValue(bv, true), formatCompareValue(cv, true), formatCompareValue(delta, true), pct, status)
+	}
+	fmt.Printf("[COMPARE] regressions=%d tolerance_pct=%g lost_tolerance=%g\n",
+		len(regressions), compareCfg.TolerancePct, compareCfg.LostTolerance)
+	return regressions
+}
+
+func formatCompareValue(v float64, ok bool) string {
+	if !ok {
+		return "n/a"
+	}
+	if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+		return strconv.FormatInt(int64(v), 10)
+	}
+	return strconv.FormatFloat(v, 'f', 3, 64)
+}
@@ -0,0 +1,127 @@
+package propher
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+)
+
+// Способы сопоставления результата с сообщением источника.
+const (
+	correlateMessageID = "message_id"
+	correlateTrace     = "trace"
+	// correlateAuto - по message_id, а если он не найден в источнике - по trace id.
+	correlateAuto = "auto"
+)
+
+func validCorrelateBy(by string) error {
+	switch by {
+	case correlateMessageID, correlateTrace, correlateAuto:
+		return nil
+	}
+	return fmt.Errorf("correlate-by must be message_id, trace or auto")
+}
+
+// parseTraceparent разбирает W3C traceparent "00-<trace-id>-<parent-id>-<flags>".
+func parseTraceparent(s string) (traceID, spanID string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || len(parts[3]) != 2 {
+		return "", "", false
+	}
+	traceID, spanID = strings.ToLower(parts[1]), strings.ToLower(parts[2])
+	if !isHexID(traceID, 32) || !isHexID(spanID, 16) {
+		return "", "", false
+	}
+	return traceID, spanID, true
+}
+
+// newTraceparent генерирует W3C traceparent с новыми trace id и parent id, флаг sampled.
+func newTraceparent() string {
+	var hi, lo uint64
+	for hi|lo == 0 {
+		hi, lo = rand.Uint64(), rand.Uint64()
+	}
+	span := rand.Uint64()
+	for span == 0 {
+		span = rand.Uint64()
+	}
+	return fmt.Sprintf("00-%016x%016x-%016x-01", hi, lo, span)
+}
+
+// isHexID - строка из n hex-символов, не все нули.
+func isHexID(s string, n int) bool {
+	if len(s) != n || strings.Trim(s, "0") == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// traceKey - ключ сопоставления: из traceparent берется только trace id,
+// span id у сервиса будет своим.
+func traceKey(s string) string {
+	if traceID, _, ok := parseTraceparent(s); ok {
+		return traceID
+	}
+	s = strings.TrimSpace(s)
+	if isHexID(s, 32) {
+		return strings.ToLower(s)
+	}
+	return s
+}
+
+// buildTraceIndex строит индекс trace id -> message_id по исходному дампу.
+// Trace id нескольких сообщений неоднозначен и в индекс не попадает.
+func buildTraceIndex(sourceIndex map[string]sourceRecord, traceField string) (index map[string]string, ambiguous int) {
+	index = make(map[string]string, len(sourceIndex))
+	dup := map[string]bool{}
+	for msgID, src := range sourceIndex {
+		obj, err := decodeJSONMap(src.Raw)
+		if err != nil {
+			continue
+		}
+		v, ok := lookupString(obj, traceField)
+		if !ok || v == "" {
+			continue
+		}
+		key := traceKey(v)
+		if dup[key] {
+			continue
+		}
+		if _, exists := index[key]; exists {
+			delete(index, key)
+			dup[key] = true
+			ambiguous++
+			continue
+		}
+		index[key] = msgID
+	}
+	return index, ambiguous
+}
+
+// matchSource находит сообщение источника для записи.
+// При сопоставлении по trace id MessageID заменяется на message_id источника,
+// а идентификатор из результата сохраняется в ResultMessageID.
+func matchSource(rec *Record, by string, sourceIndex map[string]sourceRecord, traceIndex map[string]string) (sourceRecord, bool) {
+	if by != correlateTrace && rec.MessageID != "" {
+		if src, ok := sourceIndex[rec.MessageID]; ok {
+			return src, true
+		}
+	}
+	if by == correlateMessageID || rec.TraceID == "" {
+		return sourceRecord{}, false
+	}
+	msgID, ok := traceIndex[traceKey(rec.TraceID)]
+	if !ok {
+		return sourceRecord{}, false
+	}
+	if rec.MessageID != msgID {
+		rec.ResultMessageID = rec.MessageID
+		rec.MessageID = msgID
+	}
+	return sourceIndex[msgID], true
+}
@@ -0,0 +1,327 @@
+package propher
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"propher/internal"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// dashboardRefresh - период перерисовки TUI.
+	dashboardRefresh = 250 * time.Millisecond
+	// dashboardWindowSec - окно скользящих скоростей и персентилей.
+	dashboardWindowSec = 5
+	// dashboardLogLines - сколько последних строк лога показывать.
+	dashboardLogLines = 6
+	dashboardBarWidth = 40
+)
+
+// rollingSlot - записи одной секунды чтения.
+type rollingSlot struct {
+	sec   int64
+	count int
+	serve *hdrHistogram
+	lat   *hdrHistogram
+}
+
+// dashboardState накапливает данные для TUI.
+// Не потокобезопасен: вызывается под мьютексом measureCollector.
+type dashboardState struct {
+	digits    int
+	slots     [dashboardWindowSec]rollingSlot
+	reasons   map[string]int
+	sentTimes []int64
+}
+
+func newDashboardState(digits int, sourceIndex map[string]sourceRecord) *dashboardState {
+	d := &dashboardState{
+		digits:    digits,
+		reasons:   make(map[string]int),
+		sentTimes: sortedSentTimes(sourceIndex),
+	}
+	for i := range d.slots {
+		d.slots[i].serve = newHDRHistogram(digits)
+		d.slots[i].lat = newHDRHistogram(digits)
+	}
+	return d
+}
+
+func (d *dashboardState) observe(rec Record, readUs int64) {
+	sec := readUs / 1_000_000
+	slot := &d.slots[sec%dashboardWindowSec]
+	if slot.sec != sec {
+		slot.sec = sec
+		slot.count = 0
+		slot.serve = newHDRHistogram(d.digits)
+		slot.lat = newHDRHistogram(d.digits)
+	}
+	slot.count++
+	if rec.OK {
+		slot.serve.Record(*rec.ServeUs)
+		slot.lat.Record(*rec.LatencyUs)
+	} else {
+		d.reasons[errorReason(rec.Error)]++
+	}
+}
+
+// dashboardSnapshot - состояние прогона на момент перерисовки.
+type dashboardSnapshot struct {
+	Found, Target      int
+	Total, OK, Bad     int
+	SendRate, RecvRate float64
+	ServeP50, ServeP99 int64
+	LatP50, LatP99     int64
+	WindowHasLatencies bool
+	Reasons            map[string]int
+	StopReason         string
+}
+
+// dashboardSnapshot снимает состояние коллектора за последние dashboardWindowSec секунд.
+func (c *measureCollector) dashboardSnapshot(nowUs, startUs int64) dashboardSnapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snap := dashboardSnapshot{
+		Found:      c.foundCount,
+		Target:     c.targetCount,
+		Total:      c.total,
+		OK:         c.okCount,
+		Bad:        c.badCount,
+		StopReason: c.stopReason,
+	}
+	d := c.dash
+	if d == nil {
+		return snap
+	}
+
+	// Окно не длиннее прошедшего с начала прогона времени.
+	windowUs := min(int64(dashboardWindowSec)*1_000_000, nowUs-startUs)
+	if windowUs > 0 {
+		snap.SendRate = float64(countSentBetween(d.sentTimes, nowUs-windowUs, nowUs)) / (float64(windowUs) / 1_000_000.0)
+	}
+	nowSec := nowUs / 1_000_000
+	serve := newHDRHistogram(d.digits)
+	lat := newHDRHistogram(d.digits)
+	received := 0
+	for _, slot := range d.slots {
+		if slot.sec <= nowSec-dashboardWindowSec || slot.sec > nowSec {
+			continue
+		}
+		received += slot.count
+		serve.Merge(slot.serve)
+		lat.Merge(slot.lat)
+	}
+	// Слоты покрывают dashboardWindowSec-1 полных секунд и прошедшую часть текущей.
+	recvWindowUs := min(nowUs-(nowSec-dashboardWindowSec+1)*1_000_000, nowUs-startUs)
+	if recvWindowUs > 0 {
+		snap.RecvRate = float64(received) / (float64(recvWindowUs) / 1_000_000.0)
+	}
+	if lat.Count() > 0 {
+		snap.WindowHasLatencies = true
+		snap.ServeP50 = serve.ValueAtQuantile(0.50)
+		snap.ServeP99 = serve.ValueAtQuantile(0.99)
+		snap.LatP50 = lat.ValueAtQuantile(0.50)
+		snap.LatP99 = lat.ValueAtQuantile(0.99)
+	}
+	snap.Reasons = make(map[string]int, len(d.reasons))
+	for k, v := range d.reasons {
+		snap.Reasons[k] = v
+	}
+	return snap
+}
+
+// logTail перехватывает measureLogger на время работы TUI.
+// Полный лог для вывода после панели копится во временном файле, а не в памяти:
+// с -log-records за долгий прогон строк слишком много.
+type logTail struct {
+	mu    sync.Mutex
+	spill *os.File
+	lines []string
+}
+
+// newLogTail создает временный файл лога; без него после панели печатаются только последние строки.
+func newLogTail() *logTail {
+	t := &logTail{}
+	if f, err := os.CreateTemp("", "propher-tui-*.log"); err == nil {
+		t.spill = f
+	}
+	return t
+}
+
+func (t *logTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.spill != nil {
+		if _, err := t.spill.Write(p); err != nil {
+			t.closeSpill()
+		}
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		t.lines = append(t.lines, line)
+	}
+	if n := len(t.lines); n > dashboardLogLines {
+		t.lines = append(t.lines[:0], t.lines[n-dashboardLogLines:]...)
+	}
+	return len(p), nil
+}
+
+func (t *logTail) tail() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.lines...)
+}
+
+func (t *logTail) closeSpill() {
+	t.spill.Close()
+	os.Remove(t.spill.Name())
+	t.spill = nil
+}
+
+// replay выводит перехваченный лог целиком (или последние строки) и удаляет временный файл.
+func (t *logTail) replay(w io.Writer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.spill != nil {
+		if _, err := t.spill.Seek(0, io.SeekStart); err == nil {
+			if _, err := io.Copy(w, t.spill); err == nil {
+				t.closeSpill()
+				return
+			}
+		}
+		t.closeSpill()
+	}
+	for _, line := range t.lines {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// dashboard перерисовывает состояние измерения в терминале.
+type dashboard struct {
+	out       io.Writer
+	coll      *measureCollector
+	rdb       *redis.Client
+	obsQueue  string
+	holdQueue string
+	startUs   int64
+	endUs     int64
+	log       *logTail
+}
+
+// startDashboard перехватывает лог и запускает перерисовку; stop возвращает лог на место.
+func startDashboard(d *dashboard) (stop func()) {
+	d.out = measureLogger.Writer()
+	d.log = newLogTail()
+	measureLogger.SetOutput(d.log)
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	fmt.Fprint(d.out, "\x1b[?25l\x1b[2J")
+	go func() {
+		defer close(stopped)
+		t := time.NewTicker(dashboardRefresh)
+		defer t.Stop()
+		for {
+			d.render(internal.NowMicros())
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+		d.render(internal.NowMicros())
+		fmt.Fprint(d.out, "\x1b[?25h\n")
+		measureLogger.SetOutput(d.out)
+		// Перехваченный лог печатаем целиком после панели.
+		d.log.replay(d.out)
+	}
+}
+
+// queueLen возвращает длину очереди или n/a при ошибке.
+func (d *dashboard) queueLen(key string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), dashboardRefresh)
+	defer cancel()
+	n, err := d.rdb.LLen(ctx, key).Result()
+	if err != nil {
+		return "n/a"
+	}
+	return fmt.Sprintf("%d", n)
+}
+
+func (d *dashboard) render(nowUs int64) {
+	snap := d.coll.dashboardSnapshot(nowUs, d.startUs)
+
+	var b strings.Builder
+	line := func(format string, args ...any) {
+		fmt.Fprintf(&b, format, args...)
+		b.WriteString("\x1b[K\n")
+	}
+
+	elapsed := float64(nowUs-d.startUs) / 1_000_000.0
+	total := float64(d.endUs-d.startUs) / 1_000_000.0
+	b.WriteString("\x1b[H")
+	line("propher measure-list-latency   elapsed %.1fs / %.0fs", elapsed, total)
+	line("")
+
+	ratio := 0.0
+	if snap.Target > 0 {
+		ratio = float64(snap.Found) / float64(snap.Target)
+	}
+	filled := int(ratio * dashboardBarWidth)
+	line("progress  [%s%s] %d/%d found (%.1f%%)",
+		strings.Repeat("#", filled), strings.Repeat("-", dashboardBarWidth-filled),
+		snap.Found, snap.Target, ratio*100)
+	line("records   read=%d ok=%d bad=%d", snap.Total, snap.OK, snap.Bad)
+	line("rate      send=%.1f msg/s  recv=%.1f msg/s  (last %ds)", snap.SendRate, snap.RecvRate, dashboardWindowSec)
+	if snap.WindowHasLatencies {
+		line("serve_us  p50=%d p99=%d", snap.ServeP50, snap.ServeP99)
+		line("latency   p50=%d p99=%d", snap.LatP50, snap.LatP99)
+	} else {
+		line("serve_us  p50=- p99=-")
+		line("latency   p50=- p99=-")
+	}
+	line("queues    %s=%s  %s=%s", d.obsQueue, d.queueLen(d.obsQueue), d.holdQueue, d.queueLen(d.holdQueue))
+
+	reasons := make([]string, 0, len(snap.Reasons))
+	for k := range snap.Reasons {
+		reasons = append(reasons, k)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if snap.Reasons[reasons[i]] != snap.Reasons[reasons[j]] {
+			return snap.Reasons[reasons[i]] > snap.Reasons[reasons[j]]
+		}
+		return reasons[i] < reasons[j]
+	})
+	if len(reasons) == 0 {
+		line("errors    none")
+	} else {
+		parts := make([]string, 0, len(reasons))
+		for _, k := range reasons {
+			parts = append(parts, fmt.Sprintf("%s=%d", k, snap.Reasons[k]))
+		}
+		line("errors    %s", strings.Join(parts, "  "))
+	}
+	if snap.StopReason != "" {
+		line("stopped   %s", snap.StopReason)
+	} else {
+		line("")
+	}
+	line("")
+	for _, l := range d.log.tail() {
+		line("%s", l)
+	}
+	b.WriteString("\x1b[J")
+	io.WriteString(d.out, b.String())
+}
@@ -0,0 +1,37 @@
+package propher
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+// dashboardAt - источник и обработчик, идущие ровно со 100 сообщениями/с от t=10s до nowUs.
+func dashboardAt(nowUs int64) *measureCollector {
+	source := make(map[string]sourceRecord)
+	dash := newDashboardState(2, nil)
+	serve, lat := int64(100), int64(200)
+	for us := int64(10_000_000); us < nowUs; us += 10_000 {
+		source[strconv.FormatInt(us, 10)] = sourceRecord{SentUs: us}
+		dash.observe(Record{OK: true, ServeUs: &serve, LatencyUs: &lat}, us)
+	}
+	dash.sentTimes = sortedSentTimes(source)
+	return &measureCollector{dash: dash}
+}
+
+func TestDashboardRatesSameWindow(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		nowUs, startUs int64
+	}{
+		{"mid-second", 16_500_000, 0},
+		{"second boundary", 17_000_000, 0},
+		{"start of second", 15_010_001, 0},
+		{"short run", 12_300_000, 10_000_000},
+	} {
+		snap := dashboardAt(tt.nowUs).dashboardSnapshot(tt.nowUs, tt.startUs)
+		if math.Abs(snap.RecvRate-100) > 1 || math.Abs(snap.SendRate-100) > 1 {
+			t.Errorf("%s: send=%.2f recv=%.2f, want 100", tt.name, snap.SendRate, snap.RecvRate)
+		}
+	}
+}
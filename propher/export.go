@@ -0,0 +1,386 @@
+package propher
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// extraField - поле исходного или результирующего сообщения, копируемое в Record.
+type extraField struct {
+	// Column - имя колонки в выгрузке и ключ в Record.Extra.
+	Column string
+	// Source - брать поле из исходного сообщения, иначе из результата.
+	Source bool
+	Field  string
+}
+
+// parseExtraFields разбирает список вида "tenant,source:type".
+func parseExtraFields(s string) ([]extraField, error) {
+	var out []extraField
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		f := extraField{Field: part}
+		if name, ok := strings.CutPrefix(part, "source:"); ok {
+			f = extraField{Source: true, Field: name, Column: "source_" + name}
+		} else if name, ok := strings.CutPrefix(part, "result:"); ok {
+			f = extraField{Field: name, Column: name}
+		} else {
+			f.Column = part
+		}
+		if f.Field == "" {
+			return nil, fmt.Errorf("empty field name in %q", part)
+		}
+		if err := validateFieldPaths(f.Field); err != nil {
+			return nil, err
+		}
+		f.Column = sanitizeColumn(f.Column)
+		if slices.Contains(recordColumnOrder, f.Column) || seen[f.Column] {
+			return nil, fmt.Errorf("duplicate column %q", f.Column)
+		}
+		seen[f.Column] = true
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// sanitizeColumn оставляет в имени колонки только буквы, цифры и подчеркивания.
+func sanitizeColumn(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+func hasSourceExtra(fields []extraField) bool {
+	for _, f := range fields {
+		if f.Source {
+			return true
+		}
+	}
+	return false
+}
+
+// extraValue приводит значение поля к строке; объекты и массивы - как JSON.
+func extraValue(v any) (string, bool) {
+	switch v.(type) {
+	case map[string]any, []any:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", false
+		}
+		return string(b), true
+	}
+	return extractString(v)
+}
+
+// fillExtra копирует выбранные поля сообщения в rec.Extra.
+func fillExtra(rec *Record, obj map[string]any, fields []extraField, source bool) {
+	for _, f := range fields {
+		if f.Source != source {
+			continue
+		}
+		raw, _ := lookupField(obj, f.Field)
+		v, ok := extraValue(raw)
+		if !ok {
+			continue
+		}
+		if rec.Extra == nil {
+			rec.Extra = make(map[string]string, len(fields))
+		}
+		rec.Extra[f.Column] = v
+	}
+}
+
+// recordColumnOrder - фиксированные колонки выгрузки Record, в порядке заголовка.
+var recordColumnOrder = []string{
+	"ok", "error", "message_id",
+	"source_sent_us", "result_sent_us",
+	"serve_us", "latency_us", "process_us",
+	"source_bytes", "result_bytes",
+	"excluded",
+	"trace_id", "result_message_id",
+}
+
+// hopColumn - колонка длительности участка конвейера.
+func hopColumn(hop string) string {
+	return "hop_" + sanitizeColumn(hop) + "_us"
+}
+
+// stageColumns - колонки -stages: признак нарушения порядка и по колонке на участок.
+func stageColumns(hops []string) []string {
+	if len(hops) == 0 {
+		return nil
+	}
+	cols := []string{"stages_out_of_order"}
+	for _, h := range hops {
+		cols = append(cols, hopColumn(h))
+	}
+	return cols
+}
+
+// recordExporter пишет поток Record в дополнительный формат.
+type recordExporter interface {
+	Write(rec Record) error
+	Close() error
+	Path() string
+}
+
+// buildExportPath строит путь выгрузки рядом с latency.jsonl.
+func buildExportPath(outJSONL, ext string) string {
+	trimmed := strings.TrimSpace(outJSONL)
+	return strings.TrimSuffix(trimmed, ".jsonl") + "." + ext
+}
+
+// createRecordExporters открывает выгрузки из списка форматов "csv,parquet".
+// hops - участки -stages (см. stageHops), пусто - без колонок участков.
+func createRecordExporters(formats, outJSONL string, extra []extraField, hops []string) ([]recordExporter, error) {
+	seen := map[string]bool{}
+	for _, x := range extra {
+		seen[x.Column] = true
+	}
+	for _, col := range stageColumns(hops) {
+		if seen[col] {
+			return nil, fmt.Errorf("duplicate export column %q from -stages", col)
+		}
+		seen[col] = true
+	}
+	var out []recordExporter
+	closeAll := func() {
+		for _, e := range out {
+			e.Close()
+		}
+	}
+	for _, format := range strings.Split(formats, ",") {
+		format = strings.TrimSpace(format)
+		var (
+			e   recordExporter
+			err error
+		)
+		switch format {
+		case "":
+			continue
+		case "csv":
+			e, err = newCSVExporter(buildExportPath(outJSONL, "csv"), extra, hops)
+		case "parquet":
+			e, err = newParquetExporter(buildExportPath(outJSONL, "parquet"), extra, hops)
+		default:
+			err = fmt.Errorf("unknown export format %q (want csv or parquet)", format)
+		}
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// csvExporter пишет Record в CSV со стабильным заголовком.
+type csvExporter struct {
+	path   string
+	f      *os.File
+	w      *csv.Writer
+	extra  []extraField
+	hops   []string
+	row    []string
+	closed bool
+}
+
+func newCSVExporter(path string, extra []extraField, hops []string) (*csvExporter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create csv file: %w", err)
+	}
+	e := &csvExporter{path: path, f: f, w: csv.NewWriter(f), extra: extra, hops: hops}
+	header := append([]string(nil), recordColumnOrder...)
+	header = append(header, stageColumns(hops)...)
+	for _, x := range extra {
+		header = append(header, x.Column)
+	}
+	if err := e.w.Write(header); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("write csv header: %w", err)
+	}
+	return e, nil
+}
+
+// hopValue - длительность участка или nil, если участок не посчитан.
+func hopValue(rec Record, hop string) *int64 {
+	if v, ok := rec.HopsUs[hop]; ok {
+		return &v
+	}
+	return nil
+}
+
+func formatOptionalInt(v *int64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatInt(*v, 10)
+}
+
+// formatSize - размер сообщения; пусто, если неизвестен.
+func formatSize(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+func (e *csvExporter) Write(rec Record) error {
+	e.row = append(e.row[:0],
+		strconv.FormatBool(rec.OK),
+		rec.Error,
+		rec.MessageID,
+		formatOptionalInt(rec.SourceSentUs),
+		formatOptionalInt(rec.ResultSentUs),
+		formatOptionalInt(rec.ServeUs),
+		formatOptionalInt(rec.LatencyUs),
+		formatOptionalInt(rec.ProcessUs),
+		formatSize(rec.SourceBytes),
+		formatSize(rec.ResultBytes),
+		rec.Excluded,
+		rec.TraceID,
+		rec.ResultMessageID,
+	)
+	if len(e.hops) > 0 {
+		e.row = append(e.row, strconv.FormatBool(rec.StagesOutOfOrder))
+		for _, h := range e.hops {
+			e.row = append(e.row, formatOptionalInt(hopValue(rec, h)))
+		}
+	}
+	for _, x := range e.extra {
+		e.row = append(e.row, rec.Extra[x.Column])
+	}
+	if err := e.w.Write(e.row); err != nil {
+		return fmt.Errorf("write csv: %w", err)
+	}
+	return nil
+}
+
+// Close сбрасывает буфер и закрывает файл; повторный вызов безопасен.
+func (e *csvExporter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	e.w.Flush()
+	if err := e.w.Error(); err != nil {
+		e.f.Close()
+		return fmt.Errorf("flush csv: %w", err)
+	}
+	return e.f.Close()
+}
+
+func (e *csvExporter) Path() string { return e.path }
+
+// parquetExporter пишет Record в Parquet с типизированными колонками.
+type parquetExporter struct {
+	path  string
+	pw    *parquetWriter
+	extra []extraField
+	hops  []string
+	row   []parquetValue
+}
+
+func newParquetExporter(path string, extra []extraField, hops []string) (*parquetExporter, error) {
+	specs := []parquetColumnSpec{
+		{Name: "ok", Type: parquetBoolean},
+		{Name: "error", Type: parquetByteArray, Optional: true},
+		{Name: "message_id", Type: parquetByteArray, Optional: true},
+		{Name: "source_sent_us", Type: parquetInt64, Optional: true},
+		{Name: "result_sent_us", Type: parquetInt64, Optional: true},
+		{Name: "serve_us", Type: parquetInt64, Optional: true},
+		{Name: "latency_us", Type: parquetInt64, Optional: true},
+		{Name: "process_us", Type: parquetInt64, Optional: true},
+		{Name: "source_bytes", Type: parquetInt64, Optional: true},
+		{Name: "result_bytes", Type: parquetInt64, Optional: true},
+		{Name: "excluded", Type: parquetByteArray, Optional: true},
+		{Name: "trace_id", Type: parquetByteArray, Optional: true},
+		{Name: "result_message_id", Type: parquetByteArray, Optional: true},
+	}
+	if len(hops) > 0 {
+		specs = append(specs, parquetColumnSpec{Name: "stages_out_of_order", Type: parquetBoolean})
+		for _, h := range hops {
+			specs = append(specs, parquetColumnSpec{Name: hopColumn(h), Type: parquetInt64, Optional: true})
+		}
+	}
+	for _, x := range extra {
+		specs = append(specs, parquetColumnSpec{Name: x.Column, Type: parquetByteArray, Optional: true})
+	}
+	pw, err := createParquetFile(path, specs)
+	if err != nil {
+		return nil, err
+	}
+	return &parquetExporter{path: path, pw: pw, extra: extra, hops: hops}, nil
+}
+
+func parquetInt(v *int64) parquetValue {
+	if v == nil {
+		return parquetValue{Null: true}
+	}
+	return parquetValue{Int64: *v}
+}
+
+func parquetSize(n int) parquetValue {
+	if n == 0 {
+		return parquetValue{Null: true}
+	}
+	return parquetValue{Int64: int64(n)}
+}
+
+func parquetString(s string) parquetValue {
+	if s == "" {
+		return parquetValue{Null: true}
+	}
+	return parquetValue{Bytes: s}
+}
+
+func (e *parquetExporter) Write(rec Record) error {
+	e.row = append(e.row[:0],
+		parquetValue{Bool: rec.OK},
+		parquetString(rec.Error),
+		parquetString(rec.MessageID),
+		parquetInt(rec.SourceSentUs),
+		parquetInt(rec.ResultSentUs),
+		parquetInt(rec.ServeUs),
+		parquetInt(rec.LatencyUs),
+		parquetInt(rec.ProcessUs),
+		parquetSize(rec.SourceBytes),
+		parquetSize(rec.ResultBytes),
+		parquetString(rec.Excluded),
+		parquetString(rec.TraceID),
+		parquetString(rec.ResultMessageID),
+	)
+	if len(e.hops) > 0 {
+		e.row = append(e.row, parquetValue{Bool: rec.StagesOutOfOrder})
+		for _, h := range e.hops {
+			e.row = append(e.row, parquetInt(hopValue(rec, h)))
+		}
+	}
+	for _, x := range e.extra {
+		v, ok := rec.Extra[x.Column]
+		if !ok {
+			e.row = append(e.row, parquetValue{Null: true})
+			continue
+		}
+		e.row = append(e.row, parquetValue{Bytes: v})
+	}
+	return e.pw.WriteRow(e.row)
+}
+
+func (e *parquetExporter) Close() error { return e.pw.Close() }
+
+func (e *parquetExporter) Path() string { return e.path }
@@ -0,0 +1,124 @@
+package propher
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func readCSV(t *testing.T, path string) [][]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestCSVExporterCloseTwice(t *testing.T) {
+	e, err := newCSVExporter(filepath.Join(t.TempDir(), "x.csv"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Write(Record{OK: true, MessageID: "m1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+func TestCSVExporterStageColumns(t *testing.T) {
+	stages, err := parseStages("ingest_ts,meta.enrich_ts", "ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, hops := stageHops(stages)
+	extra := []extraField{{Column: "tenant", Field: "tenant"}}
+	path := filepath.Join(t.TempDir(), "x.csv")
+	e, err := newCSVExporter(path, extra, hops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve := int64(42)
+	if err := e.Write(Record{
+		OK:               true,
+		MessageID:        "m1",
+		ServeUs:          &serve,
+		TraceID:          "4bf92f3577b34da6a3ce929d0e0e4736",
+		ResultMessageID:  "svc-1",
+		HopsUs:           map[string]int64{"ingest_ts": 10, "read": -3},
+		StagesOutOfOrder: true,
+		Extra:            map[string]string{"tenant": "acme"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := readCSV(t, path)
+	if len(rows) != 2 {
+		t.Fatalf("rows = %d, want header and one record", len(rows))
+	}
+	got := map[string]string{}
+	for i, col := range rows[0] {
+		got[col] = rows[1][i]
+	}
+	wantTail := []string{"stages_out_of_order", "hop_ingest_ts_us", "hop_meta_enrich_ts_us", "hop_read_us", "tenant"}
+	if tail := rows[0][len(recordColumnOrder):]; !reflect.DeepEqual(tail, wantTail) {
+		t.Errorf("header tail = %v, want %v", tail, wantTail)
+	}
+	for col, want := range map[string]string{
+		"message_id":            "m1",
+		"serve_us":              "42",
+		"trace_id":              "4bf92f3577b34da6a3ce929d0e0e4736",
+		"result_message_id":     "svc-1",
+		"stages_out_of_order":   "true",
+		"hop_ingest_ts_us":      "10",
+		"hop_meta_enrich_ts_us": "",
+		"hop_read_us":           "-3",
+		"tenant":                "acme",
+	} {
+		if got[col] != want {
+			t.Errorf("%s = %q, want %q", col, got[col], want)
+		}
+	}
+}
+
+func TestCreateRecordExportersDuplicateHopColumn(t *testing.T) {
+	extra := []extraField{{Column: "hop_read_us", Field: "x"}}
+	_, err := createRecordExporters("csv", filepath.Join(t.TempDir(), "latency.jsonl"), extra, []string{"read"})
+	if err == nil {
+		t.Errorf("want duplicate column error")
+	}
+}
+
+func TestFieldFlagsRejectBadPaths(t *testing.T) {
+	for _, s := range []string{"meta..ts", "items[x]", "source:meta..ts", "result:items[0"} {
+		if _, err := parseExtraFields(s); err == nil {
+			t.Errorf("parseExtraFields(%q): want error", s)
+		}
+	}
+	for _, s := range []string{"meta..ts", "items[x]:ms", "ingest_ts,meta.ts[-1]"} {
+		if _, err := parseStages(s, "ms"); err == nil {
+			t.Errorf("parseStages(%q): want error", s)
+		}
+	}
+	if _, err := parseExtraFields("tenant,source:meta.type,items[0].id"); err != nil {
+		t.Errorf("valid export fields: %v", err)
+	}
+	if _, err := parseStages("meta.ingest_ts:us,/timing/enrich", "ms"); err != nil {
+		t.Errorf("valid stages: %v", err)
+	}
+}
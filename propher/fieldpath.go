@@ -0,0 +1,153 @@
+package propher
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// pathStep - один шаг пути к полю: ключ объекта или индекс массива.
+type pathStep struct {
+	key   string
+	index int
+	// isIndex - шаг задан как [n] и адресует только элемент массива.
+	isIndex bool
+}
+
+// isFieldPath - имя поля задано путем, а не ключом верхнего уровня.
+func isFieldPath(field string) bool {
+	return strings.HasPrefix(field, "/") || strings.ContainsAny(field, ".[")
+}
+
+// parseFieldPath разбирает путь к полю: JSON Pointer ("/meta/timing/sent")
+// или точечную запись с индексами массивов ("meta.timing.sent", "items[0].id").
+func parseFieldPath(field string) ([]pathStep, error) {
+	if field == "" {
+		return nil, fmt.Errorf("empty field path")
+	}
+	if strings.HasPrefix(field, "/") {
+		var steps []pathStep
+		for _, tok := range strings.Split(field[1:], "/") {
+			tok = strings.ReplaceAll(strings.ReplaceAll(tok, "~1", "/"), "~0", "~")
+			steps = append(steps, pathStep{key: tok})
+		}
+		return steps, nil
+	}
+	var steps []pathStep
+	for _, seg := range strings.Split(field, ".") {
+		key, rest, _ := strings.Cut(seg, "[")
+		if key == "" && rest == "" {
+			return nil, fmt.Errorf("bad field path %q: empty segment", field)
+		}
+		if key != "" {
+			steps = append(steps, pathStep{key: key})
+		}
+		if rest == "" {
+			continue
+		}
+		// Один или несколько индексов подряд: items[0][1].
+		for _, idx := range strings.Split("["+rest, "[")[1:] {
+			n, err := strconv.Atoi(strings.TrimSuffix(idx, "]"))
+			if err != nil || n < 0 || !strings.HasSuffix(idx, "]") {
+				return nil, fmt.Errorf("bad field path %q: bad index [%s", field, idx)
+			}
+			steps = append(steps, pathStep{index: n, isIndex: true})
+		}
+	}
+	return steps, nil
+}
+
+// validateFieldPaths проверяет синтаксис путей к полям из флагов.
+func validateFieldPaths(fields ...string) error {
+	for _, f := range fields {
+		if f == "" || !isFieldPath(f) {
+			continue
+		}
+		if _, err := parseFieldPath(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// String - шаг в точечной записи.
+func (s pathStep) String() string {
+	if s.isIndex {
+		return "[" + strconv.Itoa(s.index) + "]"
+	}
+	return s.key
+}
+
+// samePath - пути адресуют одно значение: ключ "0" (items.0, /items/0) совпадает с [0].
+func samePath(a, b []pathStep) bool {
+	return slices.EqualFunc(a, b, func(x, y pathStep) bool {
+		if x.isIndex == y.isIndex {
+			return x == y
+		}
+		if x.isIndex {
+			x, y = y, x
+		}
+		return x.key == strconv.Itoa(y.index)
+	})
+}
+
+// overlapsPath - один путь ведет внутрь другого или совпадает с ним: правка одного задевает другой.
+func overlapsPath(a, b []pathStep) bool {
+	n := min(len(a), len(b))
+	return samePath(a[:n], b[:n])
+}
+
+// arrayIndex возвращает индекс шага для массива длины n.
+func (s pathStep) arrayIndex(n int) (int, bool) {
+	i := s.index
+	if !s.isIndex {
+		v, err := strconv.Atoi(s.key)
+		if err != nil {
+			return 0, false
+		}
+		i = v
+	}
+	return i, i >= 0 && i < n
+}
+
+// lookupField возвращает значение поля по имени или пути.
+// Ключ верхнего уровня с точкой в имени находится как раньше.
+func lookupField(obj map[string]any, field string) (any, bool) {
+	if v, ok := obj[field]; ok || !isFieldPath(field) {
+		return v, ok
+	}
+	steps, err := parseFieldPath(field)
+	if err != nil {
+		return nil, false
+	}
+	var cur any = obj
+	for _, s := range steps {
+		switch node := cur.(type) {
+		case map[string]any:
+			if s.isIndex {
+				return nil, false
+			}
+			v, ok := node[s.key]
+			if !ok {
+				return nil, false
+			}
+			cur = v
+		case []any:
+			i, ok := s.arrayIndex(len(node))
+			if !ok {
+				return nil, false
+			}
+			cur = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// lookupString - строковое значение поля по имени или пути.
+func lookupString(obj map[string]any, field string) (string, bool) {
+	v, _ := lookupField(obj, field)
+	return extractString(v)
+}
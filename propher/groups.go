@@ -0,0 +1,187 @@
+package propher
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// groupOther собирает записи групп сверх лимита -group-by-max.
+const groupOther = "__other__"
+
+// groupStats - статистика одной группы -group-by.
+type groupStats struct {
+	windowStats
+	OKThroughputMsgS float64 `json:"ok_throughput_msg_s"`
+	// Lost - потери группы; только если все поля группировки из исходного сообщения.
+	Lost *int `json:"lost,omitempty"`
+}
+
+// groupAggregator разбивает записи по значениям полей сообщения.
+type groupAggregator struct {
+	fields []extraField
+	max    int
+	digits int
+	groups map[string]*windowGroup
+	lost   map[string]int
+	// lostKnown - потери посчитаны по исходному дампу.
+	lostKnown bool
+}
+
+// newGroupAggregator возвращает nil, если группировка не задана.
+func newGroupAggregator(fields []extraField, max, digits int) *groupAggregator {
+	if len(fields) == 0 {
+		return nil
+	}
+	return &groupAggregator{
+		fields: fields,
+		max:    max,
+		digits: digits,
+		groups: make(map[string]*windowGroup),
+		lost:   make(map[string]int),
+	}
+}
+
+// mergeExtraFields добавляет поля группировки к выгружаемым без повторов.
+func mergeExtraFields(a, b []extraField) []extraField {
+	out := append([]extraField(nil), a...)
+	for _, f := range b {
+		dup := false
+		for _, x := range out {
+			if x.Column == f.Column {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// key склеивает значения полей группировки; отсутствующее значение - "-".
+func (g *groupAggregator) key(rec Record) string {
+	parts := make([]string, len(g.fields))
+	for i, f := range g.fields {
+		v, ok := rec.Extra[f.Column]
+		if !ok {
+			v = "-"
+		}
+		parts[i] = v
+	}
+	return strings.Join(parts, "|")
+}
+
+// resolve возвращает ключ группы, создавая ее в пределах лимита -group-by-max.
+func (g *groupAggregator) resolve(key string) string {
+	if _, ok := g.groups[key]; ok {
+		return key
+	}
+	if g.max > 0 && len(g.groups) >= g.max {
+		key = groupOther
+		if _, ok := g.groups[key]; ok {
+			return key
+		}
+	}
+	g.groups[key] = newWindowGroup(g.digits)
+	return key
+}
+
+func (g *groupAggregator) observe(rec Record) {
+	g.groups[g.resolve(g.key(rec))].observe(rec)
+}
+
+// sourceOnly - все поля группировки берутся из исходного сообщения.
+func (g *groupAggregator) sourceOnly() bool {
+	for _, f := range g.fields {
+		if !f.Source {
+			return false
+		}
+	}
+	return true
+}
+
+// countLost раскладывает потерянные сообщения по группам исходного дампа.
+func (g *groupAggregator) countLost(sourceIndex map[string]sourceRecord, lostIDs []string) {
+	if !g.sourceOnly() {
+		return
+	}
+	g.lostKnown = true
+	for _, id := range lostIDs {
+		var rec Record
+		if obj, err := decodeJSONMap(sourceIndex[id].Raw); err == nil {
+			fillExtra(&rec, obj, g.fields, true)
+		}
+		g.lost[g.resolve(g.key(rec))]++
+	}
+}
+
+// columns возвращает имена колонок группировки.
+func (g *groupAggregator) columns() []string {
+	out := make([]string, len(g.fields))
+	for i, f := range g.fields {
+		out[i] = f.Column
+	}
+	return out
+}
+
+// summary собирает статистику групп; durS - окно для пропускной способности.
+func (g *groupAggregator) summary(quantiles []float64, durS float64) map[string]*groupStats {
+	out := make(map[string]*groupStats, len(g.groups))
+	for key, grp := range g.groups {
+		st := &groupStats{
+			windowStats: windowStats{
+				Count: grp.count,
+				OK:    grp.okCount,
+				Bad:   grp.badCount,
+			},
+		}
+		if grp.okCount > 0 {
+			st.ServeUs = summarizeHistogram(grp.serveHist, quantiles, false)
+			st.LatencyUs = summarizeHistogram(grp.latHist, quantiles, false)
+		}
+		if durS > 0 {
+			st.OKThroughputMsgS = float64(grp.okCount) / durS
+		}
+		if g.lostKnown {
+			lost := g.lost[key]
+			st.Lost = &lost
+		}
+		out[key] = st
+	}
+	return out
+}
+
+// sortedGroupKeys упорядочивает группы по убыванию числа записей.
+func sortedGroupKeys(groups map[string]*groupStats) []string {
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if groups[keys[i]].Count != groups[keys[j]].Count {
+			return groups[keys[i]].Count > groups[keys[j]].Count
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// logGroups печатает строку [GROUP] на каждую группу.
+func logGroups(groups map[string]*groupStats) {
+	for _, key := range sortedGroupKeys(groups) {
+		st := groups[key]
+		serveP99, latP99 := "n/a", "n/a"
+		if st.ServeUs != nil {
+			serveP99 = strconv.FormatInt(st.ServeUs.P99, 10)
+			latP99 = strconv.FormatInt(st.LatencyUs.P99, 10)
+		}
+		lost := "n/a"
+		if st.Lost != nil {
+			lost = strconv.Itoa(*st.Lost)
+		}
+		measureLogger.Printf("[GROUP] key=%s count=%d ok=%d bad=%d ok_throughput_msg_s=%.3f serve_p99=%s latency_p99=%s lost=%s",
+			key, st.Count, st.OK, st.Bad, st.OKThroughputMsgS, serveP99, latP99, lost)
+	}
+}
@@ -0,0 +1,287 @@
+package propher
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hdrHistogram - лог-линейная гистограмма в духе HdrHistogram.
+// Значения ниже 2*10^digits хранятся точно, выше - с относительной
+// погрешностью не хуже 10^-digits. Память зависит только от диапазона
+// значений и точности, но не от числа записей.
+type hdrHistogram struct {
+	digits         int
+	subBucketCount int64
+	subBucketHalf  int64
+	subBucketMag   int
+	subBucketMask  int64
+
+	counts []int64
+	total  int64
+	min    int64
+	max    int64
+
+	// Онлайн-среднее и дисперсия (Welford) считаются точно.
+	mean float64
+	m2   float64
+}
+
+// histogramBucket - непустой интервал гистограммы для экспорта.
+type histogramBucket struct {
+	FromUs int64 `json:"from_us"`
+	ToUs   int64 `json:"to_us"`
+	Count  int64 `json:"count"`
+}
+
+func newHDRHistogram(digits int) *hdrHistogram {
+	if digits < 1 {
+		digits = 1
+	}
+	if digits > 5 {
+		digits = 5
+	}
+	largestSingleUnit := int64(2 * math.Pow10(digits))
+	subBucketMag := bits.Len64(uint64(largestSingleUnit - 1))
+	subBucketCount := int64(1) << subBucketMag
+	return &hdrHistogram{
+		digits:         digits,
+		subBucketCount: subBucketCount,
+		subBucketHalf:  subBucketCount / 2,
+		subBucketMag:   subBucketMag - 1,
+		subBucketMask:  subBucketCount - 1,
+		min:            math.MaxInt64,
+	}
+}
+
+func (h *hdrHistogram) bucketIndex(v int64) int {
+	return bits.Len64(uint64(v|h.subBucketMask)) - (h.subBucketMag + 1)
+}
+
+func (h *hdrHistogram) countsIndex(v int64) int {
+	bucketIdx := h.bucketIndex(v)
+	subBucketIdx := v >> uint(bucketIdx)
+	return int((int64(bucketIdx+1) << uint(h.subBucketMag)) + subBucketIdx - h.subBucketHalf)
+}
+
+// bounds возвращает диапазон значений [from, to], попадающих в ячейку idx.
+func (h *hdrHistogram) bounds(idx int) (int64, int64) {
+	bucketIdx := (idx >> uint(h.subBucketMag)) - 1
+	subBucketIdx := int64(idx)&(h.subBucketHalf-1) + h.subBucketHalf
+	if bucketIdx < 0 {
+		subBucketIdx -= h.subBucketHalf
+		bucketIdx = 0
+	}
+	from := subBucketIdx << uint(bucketIdx)
+	return from, from + (int64(1) << uint(bucketIdx)) - 1
+}
+
+// Record добавляет значение; отрицательные значения приводятся к нулю.
+func (h *hdrHistogram) Record(v int64) {
+	if v < 0 {
+		v = 0
+	}
+	idx := h.countsIndex(v)
+	if idx >= len(h.counts) {
+		grown := make([]int64, idx+1+int(h.subBucketHalf))
+		copy(grown, h.counts)
+		h.counts = grown
+	}
+	h.counts[idx]++
+	h.total++
+	if v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	delta := float64(v) - h.mean
+	h.mean += delta / float64(h.total)
+	h.m2 += delta * (float64(v) - h.mean)
+}
+
+// Merge добавляет содержимое другой гистограммы той же точности.
+func (h *hdrHistogram) Merge(o *hdrHistogram) {
+	if o == nil || o.total == 0 {
+		return
+	}
+	if len(o.counts) > len(h.counts) {
+		grown := make([]int64, len(o.counts))
+		copy(grown, h.counts)
+		h.counts = grown
+	}
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	n := h.total + o.total
+	delta := o.mean - h.mean
+	h.m2 += o.m2 + delta*delta*float64(h.total)*float64(o.total)/float64(n)
+	h.mean += delta * float64(o.total) / float64(n)
+	h.total = n
+	if o.min < h.min {
+		h.min = o.min
+	}
+	if o.max > h.max {
+		h.max = o.max
+	}
+}
+
+func (h *hdrHistogram) Count() int64 {
+	return h.total
+}
+
+func (h *hdrHistogram) Min() int64 {
+	if h.total == 0 {
+		return 0
+	}
+	return h.min
+}
+
+func (h *hdrHistogram) Max() int64 {
+	return h.max
+}
+
+func (h *hdrHistogram) Mean() float64 {
+	return h.mean
+}
+
+func (h *hdrHistogram) StdDev() float64 {
+	if h.total == 0 {
+		return 0
+	}
+	return math.Sqrt(h.m2 / float64(h.total))
+}
+
+// ValueAtQuantile возвращает значение персентиля q (0..1) с той же
+// семантикой ранга, что и percentile для отсортированного массива.
+func (h *hdrHistogram) ValueAtQuantile(q float64) int64 {
+	if h.total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(h.total)))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > h.total {
+		rank = h.total
+	}
+	var seen int64
+	for idx, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			_, to := h.bounds(idx)
+			if to > h.max {
+				to = h.max
+			}
+			if to < h.min {
+				to = h.min
+			}
+			return to
+		}
+	}
+	return h.max
+}
+
+// Buckets возвращает непустые ячейки в порядке возрастания значений.
+func (h *hdrHistogram) Buckets() []histogramBucket {
+	out := make([]histogramBucket, 0, 64)
+	for idx, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		from, to := h.bounds(idx)
+		out = append(out, histogramBucket{FromUs: from, ToUs: to, Count: c})
+	}
+	return out
+}
+
+// parsePercentiles разбирает список вида "50,90,99.9" в квантили 0..1.
+func parsePercentiles(s string) ([]float64, error) {
+	out := make([]float64, 0, 8)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimPrefix(strings.TrimSpace(part), "p")
+		if part == "" {
+			continue
+		}
+		p, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad percentile %q: %w", part, err)
+		}
+		if p <= 0 || p > 100 {
+			return nil, fmt.Errorf("percentile %q out of range (0, 100]", part)
+		}
+		out = append(out, p/100)
+	}
+	sort.Float64s(out)
+	return out, nil
+}
+
+// percentileLabel формирует ключ вида p99.9 для квантиля 0.999.
+func percentileLabel(q float64) string {
+	return "p" + strconv.FormatFloat(math.Round(q*1e6)/1e4, 'f', -1, 64)
+}
+
+// sortedPercentileLabels упорядочивает ключи персентилей по значению.
+func sortedPercentileLabels(m map[string]int64) []string {
+	labels := make([]string, 0, len(m))
+	for label := range m {
+		labels = append(labels, label)
+	}
+	sortPercentileLabels(labels)
+	return labels
+}
+
+// sortPercentileLabels сортирует метки вида p99.9 по числовому значению.
+func sortPercentileLabels(labels []string) {
+	sort.Slice(labels, func(i, j int) bool {
+		a, _ := strconv.ParseFloat(strings.TrimPrefix(labels[i], "p"), 64)
+		b, _ := strconv.ParseFloat(strings.TrimPrefix(labels[j], "p"), 64)
+		return a < b
+	})
+}
+
+// distributionStats - сводка распределения для stats-файла.
+type distributionStats struct {
+	Count       int64             `json:"count"`
+	Min         int64             `json:"min_us"`
+	Max         int64             `json:"max_us"`
+	Mean        float64           `json:"mean_us"`
+	StdDev      float64           `json:"stddev_us"`
+	P50         int64             `json:"p50_us"`
+	P90         int64             `json:"p90_us"`
+	P95         int64             `json:"p95_us"`
+	P99         int64             `json:"p99_us"`
+	Percentiles map[string]int64  `json:"percentiles_us,omitempty"`
+	Histogram   []histogramBucket `json:"histogram,omitempty"`
+}
+
+// summarizeHistogram строит сводку; nil для пустой гистограммы.
+func summarizeHistogram(h *hdrHistogram, quantiles []float64, withBuckets bool) *distributionStats {
+	if h == nil || h.Count() == 0 {
+		return nil
+	}
+	stats := &distributionStats{
+		Count:  h.Count(),
+		Min:    h.Min(),
+		Max:    h.Max(),
+		Mean:   h.Mean(),
+		StdDev: h.StdDev(),
+		P50:    h.ValueAtQuantile(0.50),
+		P90:    h.ValueAtQuantile(0.90),
+		P95:    h.ValueAtQuantile(0.95),
+		P99:    h.ValueAtQuantile(0.99),
+	}
+	if len(quantiles) > 0 {
+		stats.Percentiles = make(map[string]int64, len(quantiles))
+		for _, q := range quantiles {
+			stats.Percentiles[percentileLabel(q)] = h.ValueAtQuantile(q)
+		}
+	}
+	if withBuckets {
+		stats.Histogram = h.Buckets()
+	}
+	return stats
+}
@@ -0,0 +1,700 @@
+package propher
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"propher/internal/config"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxLostRows ограничивает таблицу потерь в HTML-отчете.
+const maxLostRows = 500
+
+// htmlReportData - данные для шаблона HTML-отчета.
+type htmlReportData struct {
+	Title      string
+	StatsPath  string
+	Run        []htmlKV
+	Summary    []htmlKV
+	Percentile []htmlPercentileRow
+	GroupBy    string
+	Groups     []htmlGroupRow
+	SizeBy     string
+	Sizes      []htmlGroupRow
+	Stages     []htmlStageRow
+	TailStage  string
+	Charts     []template.HTML
+	Lost       []htmlLostRow
+	LostTotal  int
+}
+
+type htmlKV struct {
+	Key   string
+	Value string
+}
+
+type htmlPercentileRow struct {
+	Label   string
+	Serve   string
+	Latency string
+}
+
+type htmlGroupRow struct {
+	Key        string
+	Count      int
+	OK         int
+	Bad        int
+	Throughput string
+	ServeP50   string
+	ServeP99   string
+	LatencyP50 string
+	LatencyP99 string
+	Lost       string
+}
+
+type htmlStageRow struct {
+	Hop        string
+	P50        string
+	P99        string
+	Missing    int
+	OutOfOrder int
+	TailMean   string
+	TailShare  string
+}
+
+type htmlLostRow struct {
+	ID   string
+	Sent string
+	Raw  string
+}
+
+// chartSeries - одна линия графика.
+type chartSeries struct {
+	Name   string
+	Color  string
+	Points [][2]float64
+}
+
+var chartColors = []string{"#1f77b4", "#d62728", "#2ca02c", "#ff7f0e", "#9467bd", "#8c564b"}
+
+// buildHTMLReportPath строит путь HTML-отчета рядом со stats-файлом.
+func buildHTMLReportPath(statsPath string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(statsPath, ".json"), ".stats") + ".report.html"
+}
+
+// buildSeriesPathFromStats находит временной ряд, записанный рядом со stats-файлом.
+func buildSeriesPathFromStats(statsPath string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(statsPath, ".json"), ".stats") + ".timeseries.jsonl"
+}
+
+// RunHTMLReport строит HTML-отчет по готовым stats/timeseries/lost файлам.
+func RunHTMLReport(cfg *config.Config) error {
+	htmlCfg := cfg.HTMLReport
+	if htmlCfg.Stats == "" {
+		return fmt.Errorf("stats file is required")
+	}
+	seriesPath := htmlCfg.Series
+	if seriesPath == "" {
+		seriesPath = buildSeriesPathFromStats(htmlCfg.Stats)
+	}
+	outPath := htmlCfg.Out
+	if outPath == "" {
+		outPath = buildHTMLReportPath(htmlCfg.Stats)
+	}
+	if err := writeHTMLReport(outPath, htmlCfg.Stats, seriesPath, htmlCfg.Lost); err != nil {
+		return err
+	}
+	measureLogger.Printf("[HTML] path=%s", outPath)
+	return nil
+}
+
+// writeHTMLReport собирает отчет; отсутствующие timeseries и lost пропускаются.
+func writeHTMLReport(outPath, statsPath, seriesPath, lostPath string) error {
+	raw, err := os.ReadFile(statsPath)
+	if err != nil {
+		return fmt.Errorf("read stats: %w", err)
+	}
+	var stats measureStatsFile
+	if err := json.Unmarshal(raw, &stats); err != nil {
+		return fmt.Errorf("parse stats: %w", err)
+	}
+	// Файлы находятся по соглашению об именах: оставшиеся от прошлого прогона не показываем.
+	if staleForRun(seriesPath, stats.Run["started_at"]) {
+		seriesPath = ""
+	}
+	if staleForRun(lostPath, stats.Run["started_at"]) {
+		lostPath = ""
+	}
+	rows, err := readSeriesRows(seriesPath)
+	if err != nil {
+		return err
+	}
+	lost, err := readLostMessages(lostPath)
+	if err != nil {
+		return err
+	}
+
+	data := htmlReportData{
+		Title:     "propher report",
+		StatsPath: statsPath,
+		LostTotal: len(lost),
+	}
+	keys := make([]string, 0, len(stats.Run))
+	for k := range stats.Run {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		data.Run = append(data.Run, htmlKV{Key: k, Value: stats.Run[k]})
+	}
+	data.Summary = []htmlKV{
+		{"total_read", strconv.Itoa(stats.TotalRead)},
+		{"ok", strconv.Itoa(stats.OK)},
+		{"bad", strconv.Itoa(stats.Bad)},
+		{"messages_in_dump", strconv.Itoa(stats.MessagesInDump)},
+		{"lost", strconv.Itoa(stats.Lost)},
+		{"lost_ratio", strconv.FormatFloat(stats.LostRatio, 'f', 4, 64)},
+		{"duration_sec", strconv.FormatFloat(stats.DurationSec, 'f', 3, 64)},
+		{"ok_throughput_msg_s", strconv.FormatFloat(stats.OKThroughputMsgS, 'f', 3, 64)},
+		{"ok_throughput_bytes_s", strconv.FormatFloat(stats.OKThroughputBytesS, 'f', 0, 64)},
+	}
+	data.Percentile = htmlPercentileRows(stats.ServeUs, stats.LatencyUs)
+	data.GroupBy = strings.Join(stats.GroupBy, ", ")
+	data.Groups = htmlGroupRows(stats.Groups)
+	data.SizeBy = stats.SizeBucketBy
+	data.Sizes = htmlSizeRows(stats.SizeBuckets)
+	if stats.Stages != nil {
+		data.Stages = htmlStageRows(stats.Stages)
+		data.TailStage = stats.Stages.TailStage
+	}
+
+	for _, d := range []struct {
+		name  string
+		stats *distributionStats
+	}{
+		{"serve_us", stats.ServeUs},
+		{"latency_us", stats.LatencyUs},
+	} {
+		if d.stats == nil || len(d.stats.Histogram) == 0 {
+			continue
+		}
+		data.Charts = append(data.Charts, svgHistogram(d.name+" histogram", d.stats.Histogram))
+	}
+	var cdf []chartSeries
+	for i, d := range []struct {
+		name  string
+		stats *distributionStats
+	}{
+		{"serve_us", stats.ServeUs},
+		{"latency_us", stats.LatencyUs},
+	} {
+		if d.stats == nil || len(d.stats.Histogram) == 0 {
+			continue
+		}
+		cdf = append(cdf, chartSeries{Name: d.name, Color: chartColors[i], Points: histogramCDF(d.stats.Histogram)})
+	}
+	if len(cdf) > 0 {
+		data.Charts = append(data.Charts, svgLineChart("CDF", "us (log)", "fraction", cdf, true))
+	}
+	if len(rows) > 0 {
+		data.Charts = append(data.Charts,
+			svgLineChart("Throughput", "seconds", "msg/s", seriesThroughput(rows), false),
+			svgLineChart("Serve time per interval", "seconds", "us", seriesPercentiles(rows, func(r measureSeriesRow) *distributionStats { return r.ServeUs }), false),
+			svgLineChart("Latency per interval", "seconds", "us", seriesPercentiles(rows, func(r measureSeriesRow) *distributionStats { return r.LatencyUs }), false),
+		)
+	}
+
+	if len(stats.SizeBuckets) > 0 {
+		data.Charts = append(data.Charts, svgLineChart("Latency by "+stats.SizeBucketBy+" payload size", "avg bytes (log)", "us", seriesBySize(stats.SizeBuckets), true))
+	}
+
+	idField := stats.Run["message_id_field"]
+	sentField := stats.Run["source_sent_field"]
+	for i, msg := range lost {
+		if i >= maxLostRows {
+			break
+		}
+		row := htmlLostRow{Raw: string(msg)}
+		if obj, err := decodeJSONMap(msg); err == nil {
+			if v, ok := lookupString(obj, idField); ok {
+				row.ID = v
+			}
+			if v, ok := lookupString(obj, sentField); ok {
+				row.Sent = v
+			}
+		}
+		data.Lost = append(data.Lost, row)
+	}
+
+	var buf bytes.Buffer
+	if err := htmlReportTemplate.Execute(&buf, data); err != nil {
+		return fmt.Errorf("render html report: %w", err)
+	}
+	if err := os.WriteFile(outPath, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("write html report: %w", err)
+	}
+	return nil
+}
+
+// staleForRun - файл изменен раньше начала прогона из stats-файла (run.started_at).
+// Без started_at (stats из report) проверить нельзя, файл считается актуальным.
+func staleForRun(path, startedAt string) bool {
+	if path == "" || startedAt == "" {
+		return false
+	}
+	started, err := time.Parse(time.RFC3339, startedAt)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.ModTime().Before(started) {
+		return false
+	}
+	measureLogger.Printf("[WARN] html report: %s is older than the run (started_at=%s), section omitted", path, startedAt)
+	return true
+}
+
+func readSeriesRows(path string) ([]measureSeriesRow, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("open timeseries: %w", err)
+	}
+	defer f.Close()
+	var rows []measureSeriesRow
+	scan := bufio.NewScanner(f)
+	scan.Buffer(make([]byte, 0, 64*1024), 32*1024*1024)
+	for scan.Scan() {
+		var row measureSeriesRow
+		if err := json.Unmarshal(scan.Bytes(), &row); err != nil {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	if err := scan.Err(); err != nil {
+		return nil, fmt.Errorf("scan timeseries: %w", err)
+	}
+	return rows, nil
+}
+
+func readLostMessages(path string) ([]json.RawMessage, error) {
+	if path == "" {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read lost: %w", err)
+	}
+	var lost []json.RawMessage
+	if err := json.Unmarshal(raw, &lost); err != nil {
+		return nil, fmt.Errorf("parse lost: %w", err)
+	}
+	return lost, nil
+}
+
+func htmlPercentileRows(serve, lat *distributionStats) []htmlPercentileRow {
+	labels := map[string]bool{}
+	for _, d := range []*distributionStats{serve, lat} {
+		if d == nil {
+			continue
+		}
+		for _, label := range []string{"p50", "p90", "p95", "p99"} {
+			labels[label] = true
+		}
+		for label := range d.Percentiles {
+			labels[label] = true
+		}
+	}
+	sorted := make([]string, 0, len(labels))
+	for label := range labels {
+		sorted = append(sorted, label)
+	}
+	sortPercentileLabels(sorted)
+	value := func(d *distributionStats, stat string) string {
+		if d == nil {
+			return ""
+		}
+		v, ok := lookupDistribution(d, stat)
+		if !ok {
+			return ""
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	rows := make([]htmlPercentileRow, 0, len(sorted)+4)
+	for _, label := range append([]string{"min", "mean", "stddev"}, append(sorted, "max")...) {
+		rows = append(rows, htmlPercentileRow{Label: label, Serve: value(serve, label), Latency: value(lat, label)})
+	}
+	return rows
+}
+
+func histogramCDF(buckets []histogramBucket) [][2]float64 {
+	var total int64
+	for _, b := range buckets {
+		total += b.Count
+	}
+	points := make([][2]float64, 0, len(buckets))
+	var seen int64
+	for _, b := range buckets {
+		seen += b.Count
+		points = append(points, [2]float64{float64(max(b.ToUs, 1)), float64(seen) / float64(total)})
+	}
+	return points
+}
+
+func seriesThroughput(rows []measureSeriesRow) []chartSeries {
+	t0 := rows[0].StartUs
+	sent := chartSeries{Name: "sent", Color: chartColors[0]}
+	recv := chartSeries{Name: "received", Color: chartColors[2]}
+	ok := chartSeries{Name: "ok", Color: chartColors[3]}
+	for _, r := range rows {
+		x := float64(r.StartUs-t0) / 1_000_000.0
+		sent.Points = append(sent.Points, [2]float64{x, r.SentMsgS})
+		recv.Points = append(recv.Points, [2]float64{x, r.RecvMsgS})
+		ok.Points = append(ok.Points, [2]float64{x, r.OKMsgS})
+	}
+	return []chartSeries{sent, recv, ok}
+}
+
+// seriesBySize - p50/p99 serve и latency по диапазонам размера; x - средний размер диапазона.
+func seriesBySize(buckets []sizeBucketStats) []chartSeries {
+	out := []chartSeries{
+		{Name: "serve p50", Color: chartColors[0]},
+		{Name: "serve p99", Color: chartColors[3]},
+		{Name: "latency p50", Color: chartColors[2]},
+		{Name: "latency p99", Color: chartColors[1]},
+	}
+	for _, b := range buckets {
+		if b.ServeUs == nil || b.LatencyUs == nil {
+			continue
+		}
+		out[0].Points = append(out[0].Points, [2]float64{b.AvgBytes, float64(b.ServeUs.P50)})
+		out[1].Points = append(out[1].Points, [2]float64{b.AvgBytes, float64(b.ServeUs.P99)})
+		out[2].Points = append(out[2].Points, [2]float64{b.AvgBytes, float64(b.LatencyUs.P50)})
+		out[3].Points = append(out[3].Points, [2]float64{b.AvgBytes, float64(b.LatencyUs.P99)})
+	}
+	return out
+}
+
+func seriesPercentiles(rows []measureSeriesRow, pick func(measureSeriesRow) *distributionStats) []chartSeries {
+	t0 := rows[0].StartUs
+	p50 := chartSeries{Name: "p50", Color: chartColors[0]}
+	p99 := chartSeries{Name: "p99", Color: chartColors[1]}
+	maxS := chartSeries{Name: "max", Color: chartColors[4]}
+	for _, r := range rows {
+		d := pick(r)
+		if d == nil {
+			continue
+		}
+		x := float64(r.StartUs-t0) / 1_000_000.0
+		p50.Points = append(p50.Points, [2]float64{x, float64(d.P50)})
+		p99.Points = append(p99.Points, [2]float64{x, float64(d.P99)})
+		maxS.Points = append(maxS.Points, [2]float64{x, float64(d.Max)})
+	}
+	return []chartSeries{p50, p99, maxS}
+}
+
+// Размеры SVG-графиков.
+const (
+	chartW    = 720.0
+	chartH    = 260.0
+	chartPadL = 70.0
+	chartPadR = 20.0
+	chartPadT = 30.0
+	chartPadB = 40.0
+)
+
+func chartAxes(b *strings.Builder, title, xLabel, yLabel string, xTicks, yTicks []float64, xPos, yPos func(float64) float64) {
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" class="chart">`, chartW, chartH)
+	fmt.Fprintf(b, `<text x="%.0f" y="18" class="title">%s</text>`, chartW/2, template.HTMLEscapeString(title))
+	fmt.Fprintf(b, `<line x1="%.0f" y1="%.0f" x2="%.0f" y2="%.0f" class="axis"/>`, chartPadL, chartH-chartPadB, chartW-chartPadR, chartH-chartPadB)
+	fmt.Fprintf(b, `<line x1="%.0f" y1="%.0f" x2="%.0f" y2="%.0f" class="axis"/>`, chartPadL, chartPadT, chartPadL, chartH-chartPadB)
+	for _, t := range xTicks {
+		x := xPos(t)
+		fmt.Fprintf(b, `<line x1="%.1f" y1="%.0f" x2="%.1f" y2="%.0f" class="grid"/>`, x, chartPadT, x, chartH-chartPadB)
+		fmt.Fprintf(b, `<text x="%.1f" y="%.0f" class="tick" text-anchor="middle">%s</text>`, x, chartH-chartPadB+14, formatTick(t))
+	}
+	for _, t := range yTicks {
+		y := yPos(t)
+		fmt.Fprintf(b, `<line x1="%.0f" y1="%.1f" x2="%.0f" y2="%.1f" class="grid"/>`, chartPadL, y, chartW-chartPadR, y)
+		fmt.Fprintf(b, `<text x="%.0f" y="%.1f" class="tick" text-anchor="end">%s</text>`, chartPadL-4, y+4, formatTick(t))
+	}
+	fmt.Fprintf(b, `<text x="%.0f" y="%.0f" class="label" text-anchor="middle">%s</text>`, chartW/2, chartH-6, template.HTMLEscapeString(xLabel))
+	fmt.Fprintf(b, `<text x="12" y="%.0f" class="label" transform="rotate(-90 12 %.0f)" text-anchor="middle">%s</text>`, chartH/2, chartH/2, template.HTMLEscapeString(yLabel))
+}
+
+func formatTick(v float64) string {
+	abs := math.Abs(v)
+	switch {
+	case abs >= 1e6:
+		return strconv.FormatFloat(v/1e6, 'g', 3, 64) + "M"
+	case abs >= 1e3:
+		return strconv.FormatFloat(v/1e3, 'g', 3, 64) + "k"
+	default:
+		return strconv.FormatFloat(v, 'g', 3, 64)
+	}
+}
+
+func linearTicks(lo, hi float64, n int) []float64 {
+	if hi <= lo {
+		return []float64{lo}
+	}
+	step := (hi - lo) / float64(n)
+	mag := math.Pow(10, math.Floor(math.Log10(step)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if m*mag >= step {
+			step = m * mag
+			break
+		}
+	}
+	ticks := make([]float64, 0, n+2)
+	for t := math.Ceil(lo/step) * step; t <= hi+step*1e-9; t += step {
+		ticks = append(ticks, t)
+	}
+	return ticks
+}
+
+func logTicks(lo, hi float64) []float64 {
+	ticks := make([]float64, 0, 8)
+	for p := math.Floor(math.Log10(lo)); p <= math.Ceil(math.Log10(hi)); p++ {
+		if v := math.Pow(10, p); v >= lo && v <= hi {
+			ticks = append(ticks, v)
+		}
+	}
+	return ticks
+}
+
+// svgLineChart рисует линии; logX - логарифмическая ось X.
+func svgLineChart(title, xLabel, yLabel string, series []chartSeries, logX bool) template.HTML {
+	xMin, xMax := math.Inf(1), math.Inf(-1)
+	yMax := 0.0
+	for _, s := range series {
+		for _, p := range s.Points {
+			xMin = math.Min(xMin, p[0])
+			xMax = math.Max(xMax, p[0])
+			yMax = math.Max(yMax, p[1])
+		}
+	}
+	if math.IsInf(xMin, 1) {
+		return ""
+	}
+	if xMax <= xMin {
+		xMax = xMin + 1
+	}
+	if yMax <= 0 {
+		yMax = 1
+	}
+	fx := func(v float64) float64 { return v }
+	if logX {
+		xMin = math.Max(xMin, 1)
+		fx = math.Log10
+	}
+	xPos := func(v float64) float64 {
+		return chartPadL + (fx(v)-fx(xMin))/(fx(xMax)-fx(xMin))*(chartW-chartPadL-chartPadR)
+	}
+	yPos := func(v float64) float64 {
+		return chartH - chartPadB - v/yMax*(chartH-chartPadT-chartPadB)
+	}
+	xTicks := linearTicks(xMin, xMax, 6)
+	if logX {
+		xTicks = logTicks(xMin, xMax)
+	}
+
+	var b strings.Builder
+	chartAxes(&b, title, xLabel, yLabel, xTicks, linearTicks(0, yMax, 4), xPos, yPos)
+	for i, s := range series {
+		if len(s.Points) == 0 {
+			continue
+		}
+		b.WriteString(`<polyline fill="none" stroke-width="1.5" stroke="` + s.Color + `" points="`)
+		for _, p := range s.Points {
+			fmt.Fprintf(&b, "%.1f,%.1f ", xPos(math.Max(p[0], xMin)), yPos(p[1]))
+		}
+		b.WriteString(`"/>`)
+		fmt.Fprintf(&b, `<rect x="%.0f" y="%d" width="10" height="10" fill="%s"/><text x="%.0f" y="%d" class="tick">%s</text>`,
+			chartW-chartPadR-110, 34+i*14, s.Color, chartW-chartPadR-96, 43+i*14, template.HTMLEscapeString(s.Name))
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// svgHistogram перегруппировывает ячейки в лог-шкалу и рисует столбцы.
+func svgHistogram(title string, buckets []histogramBucket) template.HTML {
+	const bins = 60
+	lo := math.Max(1, float64(buckets[0].FromUs))
+	hi := math.Max(lo+1, float64(buckets[len(buckets)-1].ToUs))
+	counts := make([]int64, bins)
+	var top int64
+	for _, bk := range buckets {
+		pos := (math.Log10(math.Max(1, float64(bk.ToUs))) - math.Log10(lo)) / (math.Log10(hi) - math.Log10(lo))
+		idx := min(bins-1, max(0, int(pos*bins)))
+		counts[idx] += bk.Count
+		top = max(top, counts[idx])
+	}
+	xPos := func(v float64) float64 {
+		return chartPadL + (math.Log10(v)-math.Log10(lo))/(math.Log10(hi)-math.Log10(lo))*(chartW-chartPadL-chartPadR)
+	}
+	yPos := func(v float64) float64 {
+		return chartH - chartPadB - v/float64(top)*(chartH-chartPadT-chartPadB)
+	}
+
+	var b strings.Builder
+	chartAxes(&b, title, "us (log)", "count", logTicks(lo, hi), linearTicks(0, float64(top), 4), xPos, yPos)
+	barW := (chartW - chartPadL - chartPadR) / bins
+	for i, c := range counts {
+		if c == 0 {
+			continue
+		}
+		y := yPos(float64(c))
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`,
+			chartPadL+float64(i)*barW, y, math.Max(1, barW-1), chartH-chartPadB-y, chartColors[0])
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 24px; color: #222; }
+table { border-collapse: collapse; margin-bottom: 24px; }
+td, th { border: 1px solid #ccc; padding: 4px 8px; font-size: 13px; text-align: left; }
+th { background: #f3f3f3; }
+td.num { text-align: right; font-family: monospace; }
+td.raw { font-family: monospace; max-width: 640px; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+.chart { display: block; margin-bottom: 16px; border: 1px solid #eee; }
+.chart .title { font-size: 14px; font-weight: bold; text-anchor: middle; }
+.chart .tick { font-size: 10px; fill: #555; }
+.chart .label { font-size: 11px; fill: #333; }
+.chart .axis { stroke: #333; }
+.chart .grid { stroke: #eee; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Stats: <code>{{.StatsPath}}</code></p>
+{{if .Run}}<h2>Run configuration</h2>
+<table>{{range .Run}}<tr><th>{{.Key}}</th><td>{{.Value}}</td></tr>{{end}}</table>{{end}}
+<h2>Summary</h2>
+<table>{{range .Summary}}<tr><th>{{.Key}}</th><td class="num">{{.Value}}</td></tr>{{end}}</table>
+<h2>Distribution</h2>
+<table><tr><th>stat</th><th>serve_us</th><th>latency_us</th></tr>
+{{range .Percentile}}<tr><th>{{.Label}}</th><td class="num">{{.Serve}}</td><td class="num">{{.Latency}}</td></tr>{{end}}</table>
+{{if .Groups}}<h2>Groups by {{.GroupBy}}</h2>
+<table><tr><th>group</th><th>count</th><th>ok</th><th>bad</th><th>ok msg/s</th><th>serve p50</th><th>serve p99</th><th>latency p50</th><th>latency p99</th><th>lost</th></tr>
+{{range .Groups}}<tr><th>{{.Key}}</th><td class="num">{{.Count}}</td><td class="num">{{.OK}}</td><td class="num">{{.Bad}}</td><td class="num">{{.Throughput}}</td><td class="num">{{.ServeP50}}</td><td class="num">{{.ServeP99}}</td><td class="num">{{.LatencyP50}}</td><td class="num">{{.LatencyP99}}</td><td class="num">{{.Lost}}</td></tr>{{end}}</table>{{end}}
+{{if .Sizes}}<h2>Payload size buckets by {{.SizeBy}}</h2>
+<table><tr><th>bytes</th><th>count</th><th>ok</th><th>bad</th><th>ok msg/s</th><th>serve p50</th><th>serve p99</th><th>latency p50</th><th>latency p99</th></tr>
+{{range .Sizes}}<tr><th>{{.Key}}</th><td class="num">{{.Count}}</td><td class="num">{{.OK}}</td><td class="num">{{.Bad}}</td><td class="num">{{.Throughput}}</td><td class="num">{{.ServeP50}}</td><td class="num">{{.ServeP99}}</td><td class="num">{{.LatencyP50}}</td><td class="num">{{.LatencyP99}}</td></tr>{{end}}</table>{{end}}
+{{if .Stages}}<h2>Pipeline stages</h2>
+{{if .TailStage}}<p>Largest share of p99 tail latency: <b>{{.TailStage}}</b></p>{{end}}
+<table><tr><th>hop</th><th>p50 us</th><th>p99 us</th><th>missing</th><th>out of order</th><th>tail mean us</th><th>tail share</th></tr>
+{{range .Stages}}<tr><th>{{.Hop}}</th><td class="num">{{.P50}}</td><td class="num">{{.P99}}</td><td class="num">{{.Missing}}</td><td class="num">{{.OutOfOrder}}</td><td class="num">{{.TailMean}}</td><td class="num">{{.TailShare}}</td></tr>{{end}}</table>{{end}}
+<h2>Charts</h2>
+{{range .Charts}}{{.}}{{end}}
+<h2>Lost messages ({{.LostTotal}})</h2>
+{{if .Lost}}<table><tr><th>message_id</th><th>sent</th><th>raw</th></tr>
+{{range .Lost}}<tr><td>{{.ID}}</td><td class="num">{{.Sent}}</td><td class="raw">{{.Raw}}</td></tr>{{end}}</table>
+{{if gt .LostTotal (len .Lost)}}<p>Showing first {{len .Lost}} of {{.LostTotal}}.</p>{{end}}{{else}}<p>None.</p>{{end}}
+</body>
+</html>
+`))
+
+// htmlGroupRows строит строки таблицы групп в порядке убывания числа записей.
+func htmlGroupRows(groups map[string]*groupStats) []htmlGroupRow {
+	rows := make([]htmlGroupRow, 0, len(groups))
+	for _, key := range sortedGroupKeys(groups) {
+		st := groups[key]
+		row := htmlGroupRow{
+			Key:        key,
+			Count:      st.Count,
+			OK:         st.OK,
+			Bad:        st.Bad,
+			Throughput: strconv.FormatFloat(st.OKThroughputMsgS, 'f', 3, 64),
+			ServeP50:   "-",
+			ServeP99:   "-",
+			LatencyP50: "-",
+			LatencyP99: "-",
+			Lost:       "-",
+		}
+		if st.ServeUs != nil {
+			row.ServeP50 = strconv.FormatInt(st.ServeUs.P50, 10)
+			row.ServeP99 = strconv.FormatInt(st.ServeUs.P99, 10)
+		}
+		if st.LatencyUs != nil {
+			row.LatencyP50 = strconv.FormatInt(st.LatencyUs.P50, 10)
+			row.LatencyP99 = strconv.FormatInt(st.LatencyUs.P99, 10)
+		}
+		if st.Lost != nil {
+			row.Lost = strconv.Itoa(*st.Lost)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// htmlSizeRows строит строки таблицы диапазонов размера.
+func htmlSizeRows(buckets []sizeBucketStats) []htmlGroupRow {
+	rows := make([]htmlGroupRow, 0, len(buckets))
+	for _, st := range buckets {
+		row := htmlGroupRow{
+			Key:        st.Bucket,
+			Count:      st.Count,
+			OK:         st.OK,
+			Bad:        st.Bad,
+			Throughput: strconv.FormatFloat(st.OKThroughputMsgS, 'f', 3, 64),
+			ServeP50:   "-",
+			ServeP99:   "-",
+			LatencyP50: "-",
+			LatencyP99: "-",
+		}
+		if st.ServeUs != nil {
+			row.ServeP50 = strconv.FormatInt(st.ServeUs.P50, 10)
+			row.ServeP99 = strconv.FormatInt(st.ServeUs.P99, 10)
+			row.LatencyP50 = strconv.FormatInt(st.LatencyUs.P50, 10)
+			row.LatencyP99 = strconv.FormatInt(st.LatencyUs.P99, 10)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// htmlStageRows строит строки таблицы участков конвейера.
+func htmlStageRows(stages *stagesSummary) []htmlStageRow {
+	rows := make([]htmlStageRow, 0, len(stages.Hops))
+	for _, h := range stages.Hops {
+		row := htmlStageRow{
+			Hop:        h.Hop,
+			P50:        "-",
+			P99:        "-",
+			Missing:    h.Missing,
+			OutOfOrder: h.OutOfOrder,
+			TailMean:   strconv.FormatFloat(h.TailMeanUs, 'f', 0, 64),
+			TailShare:  strconv.FormatFloat(h.TailShare*100, 'f', 1, 64) + "%",
+		}
+		if h.Us != nil {
+			row.P50 = strconv.FormatInt(h.Us.P50, 10)
+			row.P99 = strconv.FormatInt(h.Us.P99, 10)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
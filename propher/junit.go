@@ -0,0 +1,173 @@
+package propher
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// junitTestSuites - корень отчета JUnit XML.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+
+	seconds float64
+}
+
+type junitTestCase struct {
+	Classname string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func formatJUnitTime(sec float64) string {
+	return strconv.FormatFloat(sec, 'f', 3, 64)
+}
+
+// add добавляет кейс и пересчитывает счетчики и время набора.
+func (s *junitTestSuite) add(tc junitTestCase, seconds float64) {
+	tc.Time = formatJUnitTime(seconds)
+	s.seconds += seconds
+	s.Time = formatJUnitTime(s.seconds)
+	s.Cases = append(s.Cases, tc)
+	s.Tests++
+	if tc.Failure != nil {
+		s.Failures++
+	}
+}
+
+// measureJUnitSuite строит набор кейсов прогона: сценарий, потери и SLO-проверки.
+func measureJUnitSuite(scenario string, stats measureStatsFile, maxLostRatio float64, slo []sloResult) junitTestSuite {
+	suite := junitTestSuite{
+		Name:      scenario,
+		Timestamp: stats.Run["started_at"],
+	}
+	classname := "propher." + scenario
+
+	// Сценарий целиком: прогон завершился и получил хотя бы один успешный ответ.
+	summary := fmt.Sprintf("total_read=%d ok=%d bad=%d duration_sec=%.3f ok_throughput_msg_s=%.3f stop_reason=%s",
+		stats.TotalRead, stats.OK, stats.Bad, stats.DurationSec, stats.OKThroughputMsgS, stats.Run["stop_reason"])
+	run := junitTestCase{
+		Classname: classname,
+		Name:      "scenario",
+		SystemOut: summary,
+	}
+	if stats.OK == 0 {
+		run.Failure = &junitFailure{
+			Type:    "scenario",
+			Message: fmt.Sprintf("no successful records: total_read=%d bad=%d", stats.TotalRead, stats.Bad),
+			Text:    summary,
+		}
+	}
+	suite.add(run, stats.DurationSec)
+
+	// Потерянные сообщения исходного дампа.
+	lost := junitTestCase{
+		Classname: classname,
+		Name:      "lost_messages",
+		SystemOut: fmt.Sprintf("lost=%d messages_in_dump=%d lost_ratio=%g max_lost_ratio=%g",
+			stats.Lost, stats.MessagesInDump, stats.LostRatio, maxLostRatio),
+	}
+	if stats.LostRatio > maxLostRatio {
+		lost.Failure = &junitFailure{
+			Type: "lost",
+			Message: fmt.Sprintf("lost %d of %d messages: lost_ratio=%g > %g",
+				stats.Lost, stats.MessagesInDump, stats.LostRatio, maxLostRatio),
+			Text: lost.SystemOut,
+		}
+	}
+	suite.add(lost, 0)
+
+	for _, r := range slo {
+		tc := junitTestCase{
+			Classname: classname + ".slo",
+			Name:      r.Expr,
+		}
+		value := "n/a"
+		if r.Found {
+			value = strconv.FormatFloat(r.Value, 'f', -1, 64)
+		}
+		tc.SystemOut = fmt.Sprintf("metric=%s value=%s op=%s threshold=%g", r.Metric, value, r.Op, r.Threshold)
+		if !r.Pass {
+			msg := fmt.Sprintf("%s: measured %s, want %s %g", r.Metric, value, r.Op, r.Threshold)
+			if !r.Found {
+				msg = fmt.Sprintf("%s: metric not found in stats, want %s %g", r.Metric, r.Op, r.Threshold)
+			}
+			tc.Failure = &junitFailure{Type: "slo", Message: msg, Text: tc.SystemOut}
+		}
+		suite.add(tc, 0)
+	}
+	return suite
+}
+
+// writeJUnit пишет наборы в файл JUnit XML.
+func writeJUnit(path string, suites ...junitTestSuite) error {
+	root := junitTestSuites{Name: "propher", Suites: suites}
+	total := 0.0
+	for _, s := range suites {
+		root.Tests += s.Tests
+		root.Failures += s.Failures
+		total += s.seconds
+	}
+	root.Time = formatJUnitTime(total)
+
+	b, err := xml.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal junit: %w", err)
+	}
+	out := append([]byte(xml.Header), b...)
+	out = append(out, '\n')
+	if err := os.WriteFile(path, out, 0o644); err != nil {
+		return fmt.Errorf("write junit: %w", err)
+	}
+	return nil
+}
+
+// junitScenarioName - имя набора: сценарий из -scenario или имя файла записей.
+func junitScenarioName(scenario, outJSONL string) string {
+	if scenario != "" {
+		return scenario
+	}
+	return strings.TrimSuffix(filepath.Base(outJSONL), ".jsonl")
+}
+
+// compareJUnitCase - кейс сравнения одного кандидата с базовым прогоном.
+func compareJUnitCase(base, cand string, regressions []string) junitTestCase {
+	tc := junitTestCase{
+		Classname: "propher.compare",
+		Name:      cand,
+		SystemOut: fmt.Sprintf("baseline=%s candidate=%s regressions=%d", base, cand, len(regressions)),
+	}
+	if len(regressions) > 0 {
+		tc.Failure = &junitFailure{
+			Type:    "regression",
+			Message: fmt.Sprintf("%d metrics regressed vs %s", len(regressions), base),
+			Text:    strings.Join(regressions, "\n"),
+		}
+	}
+	return tc
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"propher/internal"
 	"propher/internal/config"
@@ -15,6 +16,15 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// Носители traceparent в режиме загрузки.
+const (
+	traceparentPayload  = "payload"
+	traceparentProperty = "mqtt-property"
+	traceparentBoth     = "both"
+	// traceparentHeader - имя user property по W3C Trace Context для MQTT.
+	traceparentHeader = "traceparent"
+)
+
 func RunLoadDumpAndRewrite(cfg *config.Config) error {
 	// Входная точка для режима load-dump-and-rewrite.
 	return runLoadDumpAndRewrite(context.Background(), cfg, newQueueWriter)
@@ -47,8 +57,18 @@ func runLoadDumpAndRewrite(ctx context.Context, cfg *config.Config, factory queu
 	if loadCfg.InDump == "" || loadCfg.OutDump == "" {
 		return fmt.Errorf("in-dump and out-dump are required")
 	}
-	if loadCfg.EpochUnit != "ms" && loadCfg.EpochUnit != "s" {
-		return fmt.Errorf("epoch-unit must be ms or s")
+	loc, err := parseTimeZone(loadCfg.EpochTZ)
+	if err != nil {
+		return fmt.Errorf("epoch-tz: %w", err)
+	}
+	// Шкала base/step - в единице epoch-unit, для строковых форматов и auto - в ms.
+	format, keepFormat, err := parseEpochFormat(loadCfg.EpochUnit, loc)
+	if err != nil {
+		return err
+	}
+	clockUnit := "ms"
+	if format.layout == "" && !keepFormat {
+		clockUnit = format.unit
 	}
 	if loadCfg.Mode != "same" && loadCfg.Mode != "increment" {
 		return fmt.Errorf("mode must be same or increment")
@@ -62,14 +82,70 @@ func runLoadDumpAndRewrite(ctx context.Context, cfg *config.Config, factory queu
 	if loadCfg.RedisQueue != "" && loadCfg.MQTTTopic != "" {
 		return fmt.Errorf("redis-queue and mqtt-topic are mutually exclusive")
 	}
+	if loadCfg.Traceparent {
+		switch loadCfg.TraceparentCarrier {
+		case traceparentPayload, traceparentProperty, traceparentBoth:
+		default:
+			return fmt.Errorf("traceparent-carrier must be payload, mqtt-property or both")
+		}
+		if loadCfg.TraceparentField == "" || loadCfg.TraceparentField == loadCfg.SentField {
+			return fmt.Errorf("traceparent-field must be set and differ from sent-field")
+		}
+	}
+
+	if loadCfg.Repeat < 0 || loadCfg.Total < 0 {
+		return fmt.Errorf("repeat and total must not be negative")
+	}
+	// Без -repeat дамп проходится один раз, с одним -total - до набора нужного объема.
+	maxPasses := loadCfg.Repeat
+	if maxPasses == 0 && loadCfg.Total == 0 {
+		maxPasses = 1
+	}
+	if err := validateFieldPaths(loadCfg.SentField, cfg.MeasureListLatency.MessageIDField, loadCfg.OrigIDField, loadCfg.TraceparentField); err != nil {
+		return err
+	}
+	// Новые message_id нужны для повторных прогонов одного дампа: исходный id сохраняется рядом.
+	idField := cfg.MeasureListLatency.MessageIDField
+	runID := cfg.Push.RunID
+	if runID == "" {
+		runID = time.Now().UTC().Format("20060102T150405")
+	}
+	idGen, err := newMessageIDGen(loadCfg.RewriteMessageID, loadCfg.MessageIDTemplate, runID)
+	if err != nil {
+		return err
+	}
+	// Копии дампа должны отличаться message_id: при keep шаблон включается, только
+	// когда действительно начинается второй проход, но проверяется сразу.
+	var loopIDGen *messageIDGen
+	if idGen == nil && maxPasses != 1 {
+		if loopIDGen, err = newMessageIDGen(messageIDTemplate, loadCfg.MessageIDTemplate, runID); err != nil {
+			return err
+		}
+	}
+	if idGen != nil || loopIDGen != nil {
+		switch loadCfg.OrigIDField {
+		case "", idField, loadCfg.SentField:
+			return fmt.Errorf("orig-id-field must be set and differ from message-id-field and sent-field")
+		}
+	}
+
+	timeRules, err := parseTimeRules(loadCfg.Rewrites, loc, loadCfg.SentField, idField, loadCfg.OrigIDField, loadCfg.TraceparentField)
+	if err != nil {
+		return err
+	}
+
+	mut, err := loadMutator(loadCfg.Mutate, loadCfg.MutateSeed, loadCfg.SentField, idField, loadCfg.OrigIDField, loadCfg.TraceparentField)
+	if err != nil {
+		return err
+	}
 
 	base := loadCfg.BaseEpoch
 	if base == 0 {
-		if loadCfg.EpochUnit == "ms" {
-			base = internal.NowMS()
-		} else {
-			base = time.Now().Unix()
-		}
+		base = time.Now().UnixNano() / unitNanos[clockUnit]
+	}
+
+	if err := startMetricsServer(cfg.MetricsAddr); err != nil {
+		return err
 	}
 
 	inF, err := os.Open(loadCfg.InDump)
@@ -84,11 +160,9 @@ func runLoadDumpAndRewrite(ctx context.Context, cfg *config.Config, factory queu
 	}
 	defer outF.Close()
 
-	// Сканы входных строк и буфер вывода.
-	inScan := bufio.NewScanner(inF)
+	// Буфер сканера входных строк и буфер вывода.
 	// Allow big lines (messages) up to 32MB.
 	buf := make([]byte, 0, 1024*1024)
-	inScan.Buffer(buf, 32*1024*1024)
 
 	outW := bufio.NewWriterSize(outF, 1<<20)
 	defer outW.Flush()
@@ -108,68 +182,205 @@ func runLoadDumpAndRewrite(ctx context.Context, cfg *config.Config, factory queu
 		defer writer.Close(ctx)
 	}
 
+	// Свойства сообщения поддерживает только транспорт MQTT v5.
+	var propWriter queuePropertyWriter
+	if loadCfg.Traceparent && loadCfg.TraceparentCarrier != traceparentPayload {
+		pw, ok := writer.(queuePropertyWriter)
+		if !ok {
+			return fmt.Errorf("traceparent-carrier %s needs -mqtt-topic with -mqtt-version 5", loadCfg.TraceparentCarrier)
+		}
+		propWriter = pw
+	}
+
 	batch := loadCfg.BatchSize
 	if batch <= 0 {
 		batch = 1000
 	}
 	pending := 0
 
-	// Основной проход по строкам дампа.
-	for inScan.Scan() {
-		nIn++
-		line := inScan.Bytes()
-		trimmed := bytesTrimSpace(line)
-		if len(trimmed) == 0 {
-			nBad++
-			continue
+	// Временной ряд скорости отправки.
+	var (
+		series     *sendSeries
+		seriesOut  *seriesFile
+		seriesPath = buildTimeseriesPath(loadCfg.OutDump)
+	)
+	if writer != nil && cfg.SeriesInterval > 0 {
+		seriesOut, err = createSeriesFile(seriesPath)
+		if err != nil {
+			return err
 		}
+		defer seriesOut.Close()
+		series = newSendSeries(seriesOut, cfg.SeriesInterval.Microseconds(), internal.NowMicros())
+	}
 
-		var obj map[string]any
-		if err := json.Unmarshal(trimmed, &obj); err != nil {
-			nBad++
-			continue
+	// Проходы по дампу: -repeat раз или до -total сообщений; файл перечитывается, а не держится в памяти.
+	passes := 0
+passLoop:
+	for maxPasses == 0 || passes < maxPasses {
+		if passes > 0 {
+			if _, err := inF.Seek(0, io.SeekStart); err != nil {
+				return fmt.Errorf("rewind in dump: %w", err)
+			}
+			if idGen == nil && loopIDGen != nil {
+				idGen = loopIDGen
+				loadCfg.RewriteMessageID = messageIDTemplate
+				fmt.Printf("[WARN] rewrite-message-id keep overridden from pass %d: repeated messages get ids from -message-id-template %q\n", passes+1, loadCfg.MessageIDTemplate)
+			}
 		}
+		passes++
+		passOut := nOut
+		inScan := bufio.NewScanner(inF)
+		inScan.Buffer(buf, 32*1024*1024)
+
+		// Основной проход по строкам дампа.
+		for inScan.Scan() {
+			nIn++
+			line := inScan.Bytes()
+			trimmed := bytesTrimSpace(line)
+			if len(trimmed) == 0 {
+				nBad++
+				liveMetrics.badLines.Add(1)
+				continue
+			}
 
-		var v int64
-		if loadCfg.Mode == "same" {
-			v = base
-		} else {
-			v = cur
+			// Сообщение правится на уровне байтов: остальные поля, порядок ключей
+			// и точность чисел сохраняются.
+			if !json.Valid(trimmed) || trimmed[0] != '{' {
+				nBad++
+				liveMetrics.badLines.Add(1)
+				continue
+			}
+
+			inc := cur
 			cur += loadCfg.Step
-		}
-		obj[loadCfg.SentField] = v
+			v := inc
+			if loadCfg.Mode == "same" {
+				v = base
+			}
+			// Поле может быть вложенным: промежуточные объекты создаются, а сообщение,
+			// где путь упирается в значение другого типа, пропускается.
+			prev, _ := getJSONField(trimmed, loadCfg.SentField)
+			f := format
+			if keepFormat {
+				f = detectEpochFormat(prev, format, loc)
+			}
+			sentAt := time.Unix(0, v*unitNanos[clockUnit])
+			outBytes, err := setJSONField(trimmed, loadCfg.SentField, f.appendJSON(nil, sentAt))
+			if err != nil {
+				nBad++
+				liveMetrics.badLines.Add(1)
+				continue
+			}
+			// Остальные метки - по своему режиму или со сдвигом -sent-field этого сообщения,
+			// чтобы сохранить их смещения относительно него.
+			if len(timeRules) > 0 {
+				prevSent, hasPrev := detectEpochFormat(prev, f, loc).parse(prev)
+				delta := sentAt.Sub(prevSent)
+				baseAt := time.Unix(0, base*unitNanos[clockUnit])
+				incAt := time.Unix(0, inc*unitNanos[clockUnit])
+				for _, r := range timeRules {
+					if outBytes, err = r.apply(trimmed, outBytes, baseAt, incAt, delta, hasPrev); err != nil {
+						break
+					}
+				}
+				if err != nil {
+					nBad++
+					liveMetrics.badLines.Add(1)
+					continue
+				}
+			}
+			if idGen != nil {
+				orig, ok := getJSONField(outBytes, idField)
+				newID := appendJSONString(nil, idGen.next(jsonRawString(orig)))
+				outBytes, err = setJSONField(outBytes, idField, newID)
+				if err == nil && ok {
+					outBytes, err = setJSONField(outBytes, loadCfg.OrigIDField, orig)
+				}
+				if err != nil {
+					nBad++
+					liveMetrics.badLines.Add(1)
+					continue
+				}
+			}
 
-		outBytes, err := json.Marshal(obj)
-		if err != nil {
-			nBad++
-			continue
-		}
+			// Правила изменения сообщения применяются к выходному дампу и к отправке.
+			if mut != nil {
+				if outBytes, err = mut.apply(outBytes); err != nil {
+					nBad++
+					liveMetrics.badLines.Add(1)
+					continue
+				}
+			}
 
-		if _, err := outW.Write(outBytes); err != nil {
-			return fmt.Errorf("write out dump: %w", err)
-		}
-		if err := outW.WriteByte('\n'); err != nil {
-			return fmt.Errorf("write newline: %w", err)
-		}
-		nOut++
+			// traceparent всегда пишется в выходной дамп; в теле сообщения - если так выбран носитель.
+			var (
+				traceparent string
+				sendBytes   []byte
+			)
+			if loadCfg.Traceparent {
+				traceparent = newTraceparent()
+				if loadCfg.TraceparentCarrier == traceparentProperty {
+					sendBytes = outBytes
+				}
+				outBytes, err = setJSONField(outBytes, loadCfg.TraceparentField, appendJSONString(nil, traceparent))
+				if err != nil {
+					nBad++
+					liveMetrics.badLines.Add(1)
+					continue
+				}
+			}
+			if sendBytes == nil {
+				sendBytes = outBytes
+			}
 
-		// Пакетная отправка в Redis.
-		if writer != nil {
-			if err := writer.Enqueue(ctx, outBytes); err != nil {
-				return err
+			if _, err := outW.Write(outBytes); err != nil {
+				return fmt.Errorf("write out dump: %w", err)
+			}
+			if err := outW.WriteByte('\n'); err != nil {
+				return fmt.Errorf("write newline: %w", err)
+			}
+			nOut++
+			if idGen != nil {
+				idGen.commit()
 			}
-			pending++
-			if pending >= batch {
-				if err := writer.Flush(ctx); err != nil {
+			if mut != nil {
+				mut.commit()
+			}
+
+			// Пакетная отправка в Redis.
+			if writer != nil {
+				if propWriter != nil {
+					err = propWriter.EnqueueWithProperties(ctx, sendBytes, [][2]string{{traceparentHeader, traceparent}})
+				} else {
+					err = writer.Enqueue(ctx, sendBytes)
+				}
+				if err != nil {
 					return err
 				}
-				pending = 0
-				fmt.Printf("[%s] pushed=%d\n", strings.ToUpper(writer.Label()), nOut)
+				liveMetrics.observePushed(writer.Label())
+				if series != nil {
+					series.observe(internal.NowMicros())
+				}
+				pending++
+				if pending >= batch {
+					if err := writer.Flush(ctx); err != nil {
+						return err
+					}
+					pending = 0
+					fmt.Printf("[%s] pushed=%d\n", strings.ToUpper(writer.Label()), nOut)
+				}
+			}
+			if loadCfg.Total > 0 && nOut >= loadCfg.Total {
+				break passLoop
 			}
 		}
-	}
-	if err := inScan.Err(); err != nil {
-		return fmt.Errorf("scan input: %w", err)
+		if err := inScan.Err(); err != nil {
+			return fmt.Errorf("scan input: %w", err)
+		}
+		// В дампе нет ни одного годного сообщения - повторять нечего.
+		if nOut == passOut {
+			break
+		}
 	}
 
 	// Досылаем оставшийся пайплайн.
@@ -179,8 +390,31 @@ func runLoadDumpAndRewrite(ctx context.Context, cfg *config.Config, factory queu
 		}
 	}
 
+	if series != nil {
+		series.finish(internal.NowMicros())
+		if err := seriesOut.Close(); err != nil {
+			return err
+		}
+		fmt.Printf("[SERIES] path=%s interval=%s\n", seriesPath, cfg.SeriesInterval)
+	}
+
 	fmt.Printf("[DUMP] in_lines=%d out_lines=%d bad_lines_skipped=%d base=%d unit=%s mode=%s\n",
 		nIn, nOut, nBad, base, loadCfg.EpochUnit, loadCfg.Mode)
+	if maxPasses != 1 {
+		fmt.Printf("[REPEAT] passes=%d repeat=%d total=%d\n", passes, loadCfg.Repeat, loadCfg.Total)
+	}
+	if mut != nil {
+		fmt.Printf("[MUTATE] rules=%d path=%s seed=%d\n", len(mut.rules), loadCfg.Mutate, mut.seed)
+	}
+	for _, r := range timeRules {
+		fmt.Printf("[REWRITE] field=%s mode=%s format=%s rewritten=%d skipped=%d\n", r.Field, r.Mode, r.Format, r.rewritten, r.skipped)
+	}
+	if idGen != nil {
+		fmt.Printf("[MESSAGE_ID] field=%s mode=%s orig_field=%s run=%s generated=%d\n", idField, loadCfg.RewriteMessageID, loadCfg.OrigIDField, runID, idGen.n)
+	}
+	if loadCfg.Traceparent {
+		fmt.Printf("[TRACEPARENT] field=%s carrier=%s generated=%d\n", loadCfg.TraceparentField, loadCfg.TraceparentCarrier, nOut)
+	}
 
 	// Проверка состояния очереди, если доступна отчетность.
 	if reporter, ok := writer.(queueReporter); ok {
@@ -348,7 +582,14 @@ func newQueueWriter(ctx context.Context, cfg *config.Config) (queueWriter, error
 	case cfg.LoadDump.RedisQueue != "":
 		return newRedisQueueWriter(ctx, cfg)
 	case cfg.LoadDump.MQTTTopic != "":
-		return newMQTTQueueWriter(cfg)
+		switch cfg.MQTT.Version {
+		case "3.1.1":
+			return newMQTTQueueWriter(cfg)
+		case "5":
+			return newMQTT5QueueWriter(cfg)
+		default:
+			return nil, fmt.Errorf("mqtt-version must be 3.1.1 or 5")
+		}
 	default:
 		return nil, nil
 	}
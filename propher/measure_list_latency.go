@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
@@ -14,6 +15,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -34,23 +36,48 @@ type Record struct {
 	ServeUs *int64 `json:"serve_us,omitempty"`
 	// LatencyUs - задержка между result и чтением из Redis.
 	LatencyUs *int64 `json:"latency_us,omitempty"`
-}
-
-type percentileStats struct {
-	P50 int64 `json:"p50_us"`
-	P90 int64 `json:"p90_us"`
-	P95 int64 `json:"p95_us"`
-	P99 int64 `json:"p99_us"`
+	// ProcessUs - время собственной обработки сообщения в propher.
+	ProcessUs *int64 `json:"process_us,omitempty"`
+	// SourceBytes - размер исходного сообщения из дампа.
+	SourceBytes int `json:"source_bytes,omitempty"`
+	// ResultBytes - размер сообщения, прочитанного из очереди.
+	ResultBytes int `json:"result_bytes,omitempty"`
+	// HopsUs - длительности участков конвейера по -stages, ключ - точка окончания участка.
+	HopsUs map[string]int64 `json:"hops_us,omitempty"`
+	// StagesOutOfOrder - метки стадий идут не по порядку.
+	StagesOutOfOrder bool `json:"stages_out_of_order,omitempty"`
+	// TraceID - trace id из результата (поле TraceField).
+	TraceID string `json:"trace_id,omitempty"`
+	// ResultMessageID - message_id результата, если сообщение сопоставлено по trace id.
+	ResultMessageID string `json:"result_message_id,omitempty"`
+	// Excluded - окно исключения (warmup/cooldown), если запись не в статистике.
+	Excluded string `json:"excluded,omitempty"`
+	// Extra - поля, скопированные из исходного или результирующего сообщения.
+	Extra map[string]string `json:"extra,omitempty"`
 }
 
 type measureStatsFile struct {
-	TotalRead        int              `json:"total_read"`
-	OK               int              `json:"ok"`
-	Bad              int              `json:"bad"`
-	DurationSec      float64          `json:"duration_sec"`
-	OKThroughputMsgS float64          `json:"ok_throughput_msg_s"`
-	ServeUs          *percentileStats `json:"serve_us,omitempty"`
-	LatencyUs        *percentileStats `json:"latency_us,omitempty"`
+	TotalRead          int                    `json:"total_read"`
+	OK                 int                    `json:"ok"`
+	Bad                int                    `json:"bad"`
+	DurationSec        float64                `json:"duration_sec"`
+	OKThroughputMsgS   float64                `json:"ok_throughput_msg_s"`
+	OKThroughputBytesS float64                `json:"ok_throughput_bytes_s"`
+	MessagesInDump     int                    `json:"messages_in_dump"`
+	Lost               int                    `json:"lost"`
+	LostRatio          float64                `json:"lost_ratio"`
+	ServeUs            *distributionStats     `json:"serve_us,omitempty"`
+	LatencyUs          *distributionStats     `json:"latency_us,omitempty"`
+	ProcessUs          *distributionStats     `json:"process_us,omitempty"`
+	Consumers          int                    `json:"consumers"`
+	Warmup             *windowStats           `json:"warmup,omitempty"`
+	Cooldown           *windowStats           `json:"cooldown,omitempty"`
+	GroupBy            []string               `json:"group_by,omitempty"`
+	Groups             map[string]*groupStats `json:"groups,omitempty"`
+	SizeBucketBy       string                 `json:"size_bucket_by,omitempty"`
+	SizeBuckets        []sizeBucketStats      `json:"size_buckets,omitempty"`
+	Stages             *stagesSummary         `json:"stages,omitempty"`
+	Run                map[string]string      `json:"run,omitempty"`
 }
 
 var measureLogger = log.New(os.Stdout, "", log.LstdFlags|log.Lmicroseconds)
@@ -72,7 +99,12 @@ func percentile(sortedVals []int64, q float64) int64 {
 }
 
 func normalizeUnit(unit string) string {
-	return strings.ToLower(strings.TrimSpace(unit))
+	unit = strings.TrimSpace(unit)
+	// Раскладка Go чувствительна к регистру.
+	if len(unit) >= len(timeLayoutPrefix) && strings.EqualFold(unit[:len(timeLayoutPrefix)], timeLayoutPrefix) {
+		return timeLayoutPrefix + unit[len(timeLayoutPrefix):]
+	}
+	return strings.ToLower(unit)
 }
 
 func parseFloat(v any) (float64, error) {
@@ -121,63 +153,76 @@ func parseInt(v any) (int64, error) {
 }
 
 func parseFieldToEpoch(v any, unit string) (*int64, error) {
-	// Преобразуем поле в микросекунды (ISO или epoch s/ms/us).
+	// Преобразуем поле в микросекунды: epoch s/ms/us/ns (число или строка из цифр),
+	// ISO/RFC3339 с любым смещением или строка по раскладке layout:<...>.
 	if v == nil {
 		return nil, fmt.Errorf("nil value")
 	}
-	var num int64
-	var err error
 	if s, ok := v.(string); ok {
 		trimmed := strings.TrimSpace(s)
-		var parsed time.Time
 		if trimmed == "" {
 			return nil, fmt.Errorf("empty string")
 		}
-		if strings.ContainsAny(trimmed, "T:-") && strings.ContainsAny(trimmed, "Z") {
-			parsed, err = time.Parse(time.RFC3339Nano, trimmed)
-			if err == nil {
-				num = parsed.UnixMicro()
-				//return &x, nil
+		if !isNumericString(trimmed) {
+			// Строковая метка абсолютна: единица к ней не применяется.
+			parsed, err := parseTimeString(trimmed, unit)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %q: %w", trimmed, err)
 			}
-		} else if strings.ContainsAny(trimmed, "T:-") {
-			const layout = "2006-01-02T15:04:05.999999"
-			parsed, err = time.ParseInLocation(layout, trimmed, time.UTC)
-			if err == nil {
-				num = parsed.UnixMicro()
-				//return &x, nil
+			micros := parsed.UnixMicro()
+			return &micros, nil
+		}
+		v = json.Number(trimmed)
+	}
+	u := normalizeUnit(unit)
+	if strings.HasPrefix(u, timeLayoutPrefix) {
+		u = "auto"
+	}
+
+	// Дробное число - epoch с долями (обычно секунды).
+	if n, ok := v.(json.Number); ok && strings.ContainsAny(n.String(), ".eE") {
+		f, err := n.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse json.Number: %w", err)
+		}
+		if u == "auto" {
+			var ok bool
+			if u, ok = epochUnitByMagnitude(int64(f)); !ok {
+				return nil, fmt.Errorf("unknown epoch precision")
 			}
 		}
-		if num == 0 && err != nil {
-			return nil, fmt.Errorf("failed to parse %q: %w", trimmed, err)
+		nanos, ok := unitNanos[u]
+		if !ok {
+			return nil, fmt.Errorf("unsupported unit %q", unit)
 		}
-	} else {
-		num, err = parseInt(v)
-		if err != nil {
-			return nil, err
+		if ns, ok := decimalToNanos(n.String(), nanos); ok {
+			micros := ns / 1e3
+			return &micros, nil
 		}
+		micros := int64(f * float64(nanos) / 1e3)
+		return &micros, nil
 	}
-	u := normalizeUnit(unit)
-	abs := num
 
-	var micros int64
-	switch u {
-	case "auto":
-		switch {
-		case abs >= 1e15:
-			micros = num
-		case abs >= 1e12:
-			micros = num * 1_000
-		case abs >= 1e9:
-			micros = num * 1_000_000
-		default:
+	num, err := parseInt(v)
+	if err != nil {
+		return nil, err
+	}
+	if u == "auto" {
+		var ok bool
+		if u, ok = epochUnitByMagnitude(num); !ok {
 			return nil, fmt.Errorf("unknown epoch precision")
 		}
+	}
+	var micros int64
+	switch u {
 	case "s":
 		micros = num * 1_000_000
 	case "ms":
 		micros = num * 1_000
 	case "us":
 		micros = num
+	case "ns":
+		micros = num / 1_000
 	default:
 		return nil, fmt.Errorf("unsupported unit %q", unit)
 	}
@@ -256,7 +301,7 @@ func loadSourceIndex(path, idField, sentField, unit string) (map[string]sourceRe
 			stats.Bad++
 			continue
 		}
-		idVal, ok := obj[idField]
+		idVal, ok := lookupField(obj, idField)
 		if !ok {
 			stats.Bad++
 			continue
@@ -266,7 +311,7 @@ func loadSourceIndex(path, idField, sentField, unit string) (map[string]sourceRe
 			stats.Bad++
 			continue
 		}
-		sentVal, ok := obj[sentField]
+		sentVal, ok := lookupField(obj, sentField)
 		if !ok {
 			stats.Bad++
 			continue
@@ -314,6 +359,24 @@ func logRecord(rec Record) {
 	measureLogger.Printf("[RECORD] ok=false message_id=%s error=%s", rec.MessageID, rec.Error)
 }
 
+func logDistribution(tag string, stats *distributionStats) {
+	if stats == nil {
+		return
+	}
+	measureLogger.Printf("[%s] p50=%d us", tag, stats.P50)
+	measureLogger.Printf("[%s] p90=%d us", tag, stats.P90)
+	measureLogger.Printf("[%s] p95=%d us", tag, stats.P95)
+	measureLogger.Printf("[%s] p99=%d us", tag, stats.P99)
+	for _, label := range sortedPercentileLabels(stats.Percentiles) {
+		switch label {
+		case "p50", "p90", "p95", "p99":
+			continue
+		}
+		measureLogger.Printf("[%s] %s=%d us", tag, label, stats.Percentiles[label])
+	}
+	measureLogger.Printf("[%s] min=%d us max=%d us mean=%.1f us stddev=%.1f us", tag, stats.Min, stats.Max, stats.Mean, stats.StdDev)
+}
+
 func buildStatsJSONPath(outJSONL string) string {
 	trimmed := strings.TrimSpace(outJSONL)
 	if trimmed == "" {
@@ -350,6 +413,249 @@ func writeLostJSON(path string, lost []json.RawMessage) error {
 	return nil
 }
 
+// measureCollector потокобезопасно агрегирует записи от всех потребителей.
+type measureCollector struct {
+	mu sync.Mutex
+	// writeMu защищает w, exporters и exportErr.
+	writeMu     sync.Mutex
+	w           *bufio.Writer
+	sourceIndex map[string]sourceRecord
+	targetCount int
+
+	found       map[string]struct{}
+	foundCount  int
+	total       int
+	okCount     int
+	okBytes     int64
+	badCount    int
+	serveHist   *hdrHistogram
+	latHist     *hdrHistogram
+	processHist *hdrHistogram
+	series      *measureSeries
+	window      *exclusionWindow
+	excluded    map[string]*windowGroup
+	dash        *dashboardState
+	exporters   []recordExporter
+	groups      *groupAggregator
+	sizes       *sizeAggregator
+	stages      *stageAggregator
+	exportErr   error
+	logRecords  bool
+	digits      int
+	stopReason  string
+}
+
+func newMeasureCollector(w *bufio.Writer, sourceIndex map[string]sourceRecord, digits int) *measureCollector {
+	return &measureCollector{
+		w:           w,
+		sourceIndex: sourceIndex,
+		targetCount: len(sourceIndex),
+		found:       make(map[string]struct{}, len(sourceIndex)),
+		excluded:    make(map[string]*windowGroup, 2),
+		logRecords:  true,
+		digits:      digits,
+		serveHist:   newHDRHistogram(digits),
+		latHist:     newHDRHistogram(digits),
+		processHist: newHDRHistogram(digits),
+	}
+}
+
+// stop фиксирует первую причину остановки.
+func (c *measureCollector) stop(reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopReason == "" {
+		c.stopReason = reason
+	}
+}
+
+// tick закрывает завершенные интервалы временного ряда без новых записей.
+func (c *measureCollector) tick(nowUs int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.series != nil {
+		c.series.advance(nowUs)
+	}
+}
+
+func (c *measureCollector) stopped() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stopReason != ""
+}
+
+// observe учитывает запись, пишет ее в JSONL и проверяет условие остановки.
+// Сериализация и запись идут вне c.mu: под ним только счетчики и гистограммы.
+func (c *measureCollector) observe(rec Record, readUs int64) {
+	// Собственные накладные расходы: от чтения до сериализации записи.
+	processUs := internal.NowMicros() - readUs
+	rec.ProcessUs = &processUs
+	// Записи из окон прогрева/остывания считаем отдельно.
+	rec.Excluded = c.window.classify(rec, readUs)
+	b, _ := json.Marshal(rec)
+
+	c.mu.Lock()
+	c.total++
+	if rec.MessageID != "" {
+		if _, ok := c.sourceIndex[rec.MessageID]; ok {
+			if _, seen := c.found[rec.MessageID]; !seen {
+				c.found[rec.MessageID] = struct{}{}
+				c.foundCount++
+				liveMetrics.foundMessages.Store(int64(c.foundCount))
+			}
+		}
+	}
+
+	c.processHist.Record(processUs)
+	if c.series != nil {
+		c.series.observe(rec, readUs)
+	}
+	if c.dash != nil {
+		c.dash.observe(rec, readUs)
+	}
+
+	if rec.Excluded != "" {
+		g, ok := c.excluded[rec.Excluded]
+		if !ok {
+			g = newWindowGroup(c.digits)
+			c.excluded[rec.Excluded] = g
+		}
+		g.observe(rec)
+	} else if rec.OK {
+		c.okCount++
+		c.okBytes += int64(rec.ResultBytes)
+		c.serveHist.Record(*rec.ServeUs)
+		c.latHist.Record(*rec.LatencyUs)
+	} else {
+		c.badCount++
+	}
+	if rec.Excluded == "" && c.groups != nil {
+		c.groups.observe(rec)
+	}
+	if rec.Excluded == "" && c.sizes != nil {
+		c.sizes.observe(rec)
+	}
+	if rec.Excluded == "" && c.stages != nil {
+		c.stages.observe(rec)
+	}
+	if c.stopReason == "" && c.foundCount >= c.targetCount {
+		c.stopReason = "all-found"
+		measureLogger.Printf("[STOP] all_messages_found=%d", c.foundCount)
+	}
+	c.mu.Unlock()
+
+	liveMetrics.observeRecord(rec)
+
+	c.writeMu.Lock()
+	c.w.Write(b)
+	c.w.WriteByte('\n')
+	var exportErr error
+	for _, e := range c.exporters {
+		if err := e.Write(rec); err != nil && exportErr == nil && c.exportErr == nil {
+			exportErr = err
+			c.exportErr = err
+		}
+	}
+	c.writeMu.Unlock()
+	if exportErr != nil {
+		c.mu.Lock()
+		c.stopReason = "error"
+		c.mu.Unlock()
+	}
+
+	if c.logRecords {
+		logRecord(rec)
+	}
+}
+
+// buildRecord разбирает сообщение из очереди и сопоставляет его с источником.
+func buildRecord(raw []byte, ts int64, measureCfg config.MeasureListLatencyConfig, sourceIndex map[string]sourceRecord, traceIndex map[string]string, extra []extraField, stages []stageField) Record {
+	rec := Record{
+		OK:          false,
+		ResultBytes: len(raw),
+	}
+
+	// Парсим JSON объект.
+	obj, err := decodeJSONMap(raw)
+	if err != nil {
+		rec.Error = "json_parse_error: " + err.Error()
+		return rec
+	}
+	fillExtra(&rec, obj, extra, false)
+
+	// trace id - запасной ключ, если сервис переписывает message_id.
+	if measureCfg.TraceField != "" {
+		if v, ok := lookupString(obj, measureCfg.TraceField); ok {
+			rec.TraceID = v
+		}
+	}
+	byID := measureCfg.CorrelateBy == correlateMessageID
+
+	// message_id
+	msgIDVal, ok := lookupField(obj, measureCfg.MessageIDField)
+	if ok {
+		msgID, ok := extractString(msgIDVal)
+		if !ok && byID {
+			rec.Error = "bad_" + measureCfg.MessageIDField
+			return rec
+		}
+		rec.MessageID = msgID
+	} else if byID {
+		rec.Error = "missing_" + measureCfg.MessageIDField
+		return rec
+	}
+	if !byID && rec.MessageID == "" && rec.TraceID == "" {
+		rec.Error = "missing_" + measureCfg.MessageIDField + "_and_" + measureCfg.TraceField
+		return rec
+	}
+
+	// result sent_epoch
+	var resultSentUs *int64
+	if v, ok := lookupField(obj, measureCfg.T0Field); ok && v != nil {
+		x, e := parseFieldToEpoch(v, measureCfg.T0Unit)
+		if e == nil {
+			resultSentUs = x
+		}
+	}
+	rec.ResultSentUs = resultSentUs
+	if resultSentUs == nil {
+		rec.Error = "missing_or_bad_" + measureCfg.T0Field
+		return rec
+	}
+
+	sourceRec, ok := matchSource(&rec, measureCfg.CorrelateBy, sourceIndex, traceIndex)
+	if !ok {
+		rec.Error = "source_not_found"
+		return rec
+	}
+	sourceSentUs := sourceRec.SentUs
+	rec.SourceSentUs = &sourceSentUs
+	rec.SourceBytes = len(sourceRec.Raw)
+	if hasSourceExtra(extra) {
+		if srcObj, err := decodeJSONMap(sourceRec.Raw); err == nil {
+			fillExtra(&rec, srcObj, extra, true)
+		}
+	}
+
+	serveUs := *resultSentUs - sourceSentUs
+	if serveUs < 0 {
+		rec.Error = "result_sent_before_source"
+		return rec
+	}
+
+	lat := ts - *resultSentUs
+	if lat < 0 {
+		rec.Error = "result_sent_in_future"
+		return rec
+	}
+
+	rec.OK = true
+	rec.ServeUs = &serveUs
+	rec.LatencyUs = &lat
+	fillStages(&rec, obj, stages, ts)
+	return rec
+}
+
 func RunMeasureListLatency(cfg *config.Config) error {
 	// Измеряем задержку сообщений в очереди Redis.
 	measureCfg := cfg.MeasureListLatency
@@ -362,23 +668,60 @@ func RunMeasureListLatency(cfg *config.Config) error {
 	if measureCfg.MessageIDField == "" {
 		return fmt.Errorf("message-id-field is required")
 	}
+	if err := validCorrelateBy(measureCfg.CorrelateBy); err != nil {
+		return err
+	}
+	if measureCfg.CorrelateBy != correlateMessageID && measureCfg.TraceField == "" {
+		return fmt.Errorf("trace-field is required for correlate-by %s", measureCfg.CorrelateBy)
+	}
 	if measureCfg.SourceSentField == "" {
 		return fmt.Errorf("source-sent-field is required")
 	}
 	if measureCfg.T0Field == "" {
 		return fmt.Errorf("t0-field is required")
 	}
+	if err := validateFieldPaths(measureCfg.MessageIDField, measureCfg.SourceSentField, measureCfg.T0Field, measureCfg.TraceField); err != nil {
+		return err
+	}
 	if measureCfg.SourceSentUnit == "" {
 		measureCfg.SourceSentUnit = "auto"
 	}
 	if measureCfg.T0Unit == "" {
 		measureCfg.T0Unit = "auto"
 	}
-	if u := normalizeUnit(measureCfg.SourceSentUnit); u != "auto" && u != "s" && u != "ms" && u != "us" {
-		return fmt.Errorf("source-sent-unit must be auto, s, ms, or us")
+	if !validReadUnit(measureCfg.SourceSentUnit) {
+		return fmt.Errorf("source-sent-unit must be auto, s, ms, us, ns or layout:<go layout>")
+	}
+	if !validReadUnit(measureCfg.T0Unit) {
+		return fmt.Errorf("t0-unit must be auto, s, ms, us, ns or layout:<go layout>")
+	}
+	if measureCfg.HistPrecision < 1 || measureCfg.HistPrecision > 5 {
+		return fmt.Errorf("hist-precision must be between 1 and 5")
+	}
+	quantiles, err := parsePercentiles(measureCfg.Percentiles)
+	if err != nil {
+		return fmt.Errorf("percentiles: %w", err)
+	}
+	sloChecks, err := loadSLOChecks(measureCfg.SLO, measureCfg.SLOFile, quantiles)
+	if err != nil {
+		return err
+	}
+	extraFields, err := parseExtraFields(measureCfg.ExportFields)
+	if err != nil {
+		return fmt.Errorf("export-fields: %w", err)
+	}
+	groupFields, err := parseExtraFields(measureCfg.GroupBy)
+	if err != nil {
+		return fmt.Errorf("group-by: %w", err)
+	}
+	extraFields = mergeExtraFields(extraFields, groupFields)
+	sizeBounds, err := parseSizeBuckets(measureCfg.SizeBuckets)
+	if err != nil {
+		return fmt.Errorf("size-buckets: %w", err)
 	}
-	if u := normalizeUnit(measureCfg.T0Unit); u != "auto" && u != "s" && u != "ms" && u != "us" {
-		return fmt.Errorf("t0-unit must be auto, s, ms, or us")
+	stages, err := parseStages(measureCfg.Stages, measureCfg.T0Unit)
+	if err != nil {
+		return fmt.Errorf("stages: %w", err)
 	}
 
 	sourceIndex, sourceStats, err := loadSourceIndex(
@@ -395,9 +738,18 @@ func RunMeasureListLatency(cfg *config.Config) error {
 	}
 	measureLogger.Printf("[SOURCE] lines=%d indexed=%d bad=%d dup=%d",
 		sourceStats.Total, sourceStats.Indexed, sourceStats.Bad, sourceStats.Duplicates)
+	var traceIndex map[string]string
+	if measureCfg.CorrelateBy != correlateMessageID {
+		var ambiguous int
+		traceIndex, ambiguous = buildTraceIndex(sourceIndex, measureCfg.TraceField)
+		measureLogger.Printf("[SOURCE] trace_field=%s trace_indexed=%d trace_ambiguous=%d",
+			measureCfg.TraceField, len(traceIndex), ambiguous)
+	}
 	targetCount := len(sourceIndex)
-	found := make(map[string]struct{}, targetCount)
-	foundCount := 0
+	liveMetrics.targetMsgs.Store(int64(targetCount))
+	if err := startMetricsServer(cfg.MetricsAddr); err != nil {
+		return err
+	}
 
 	hq := measureCfg.HoldQueue
 	if hq == "" {
@@ -406,11 +758,18 @@ func RunMeasureListLatency(cfg *config.Config) error {
 
 	// Подключение к Redis.
 	ctx := context.Background()
+	consumers := measureCfg.Consumers
+	if consumers <= 0 {
+		consumers = 1
+	}
+	// Каждый потребитель держит соединение на время BRPOPLPUSH.
 	rdb := redis.NewClient(&redis.Options{
 		Addr:     cfg.Redis.Addr,
 		Password: cfg.Redis.Pass,
 		DB:       cfg.Redis.DB,
+		PoolSize: consumers + 2,
 	})
+	defer rdb.Close()
 
 	startUs := internal.NowMicros()
 	endUs := startUs + int64(measureCfg.DurationSec)*1_000_000
@@ -425,172 +784,148 @@ func RunMeasureListLatency(cfg *config.Config) error {
 	w := bufio.NewWriterSize(f, 1<<20)
 	defer w.Flush()
 
-	var (
-		serveTimes []int64
-		latencies  []int64
-		total      int
-		okCount    int
-		badCount   int
-		stopReason string
-	)
-
-	// Основной цикл измерений.
-	for {
-		if internal.NowMicros() >= endUs {
-			stopReason = "timeout"
-			break
+	// Дополнительные выгрузки потока Record.
+	var exportHops []string
+	if len(stages) > 0 {
+		_, exportHops = stageHops(stages)
+	}
+	exporters, err := createRecordExporters(measureCfg.Export, measureCfg.OutJSONL, extraFields, exportHops)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, e := range exporters {
+			e.Close()
 		}
-
-		// Atomic move obs -> hold
-		raw, err := rdb.BRPopLPush(ctx, measureCfg.ObsQueue, hq, time.Duration(measureCfg.BlockSec)*time.Second).Result()
+	}()
+	if measureCfg.OTLPEndpoint != "" {
+		runID := cfg.Push.RunID
+		if runID == "" {
+			runID = time.UnixMicro(startUs).UTC().Format(time.RFC3339)
+		}
+		otlp, err := newOTLPExporter(measureCfg.OTLPEndpoint, measureCfg.OTLPHeaders, measureCfg.OTLPService, map[string]string{
+			"propher.run_id":     runID,
+			"propher.scenario":   cfg.Push.Scenario,
+			"propher.git_commit": cfg.Push.GitCommit,
+		})
 		if err != nil {
-			if err == redis.Nil {
-				continue // timeout, queue empty
-			}
-			return fmt.Errorf("brpoplpush: %w", err)
+			return err
 		}
+		exporters = append(exporters, otlp)
+	}
 
-		total++
-		ts := internal.NowMicros()
-
-		rec := Record{
-			OK: false,
-		}
+	coll := newMeasureCollector(w, sourceIndex, measureCfg.HistPrecision)
+	coll.logRecords = measureCfg.LogRecords
+	coll.exporters = exporters
+	coll.groups = newGroupAggregator(groupFields, measureCfg.GroupByMax, measureCfg.HistPrecision)
+	coll.sizes, err = newSizeAggregator(sizeBounds, measureCfg.SizeBucketBy, measureCfg.HistPrecision)
+	if err != nil {
+		return err
+	}
+	coll.stages = newStageAggregator(stages, measureCfg.HistPrecision)
+	coll.window, err = newExclusionWindow(measureCfg, startUs, sourceIndex)
+	if err != nil {
+		return err
+	}
 
-		// Парсим JSON объект.
-		obj, err := decodeJSONMap([]byte(raw))
+	// Временной ряд по интервалам.
+	var seriesOut *seriesFile
+	if cfg.SeriesInterval > 0 {
+		seriesOut, err = createSeriesFile(buildTimeseriesPath(measureCfg.OutJSONL))
 		if err != nil {
-			badCount++
-			rec.Error = "json_parse_error: " + err.Error()
-			b, _ := json.Marshal(rec)
-			w.Write(b)
-			w.WriteByte('\n')
-			logRecord(rec)
-			continue
-		}
-
-		// message_id
-		msgIDVal, ok := obj[measureCfg.MessageIDField]
-		if !ok {
-			badCount++
-			rec.Error = "missing_" + measureCfg.MessageIDField
-			b, _ := json.Marshal(rec)
-			w.Write(b)
-			w.WriteByte('\n')
-			logRecord(rec)
-			continue
+			return err
 		}
-		msgID, ok := extractString(msgIDVal)
-		if !ok {
-			badCount++
-			rec.Error = "bad_" + measureCfg.MessageIDField
-			b, _ := json.Marshal(rec)
-			w.Write(b)
-			w.WriteByte('\n')
-			logRecord(rec)
-			continue
+		defer seriesOut.Close()
+		coll.series = newMeasureSeries(seriesOut, cfg.SeriesInterval.Microseconds(), startUs, measureCfg.HistPrecision, sourceIndex)
+	}
+	tickDone := make(chan struct{})
+	tickStopped := make(chan struct{})
+	go func() {
+		defer close(tickStopped)
+		if coll.series == nil {
+			return
 		}
-		rec.MessageID = msgID
-		if _, ok := sourceIndex[msgID]; ok {
-			if _, seen := found[msgID]; !seen {
-				found[msgID] = struct{}{}
-				foundCount++
+		t := time.NewTicker(cfg.SeriesInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-tickDone:
+				return
+			case <-t.C:
+				coll.tick(internal.NowMicros())
 			}
 		}
-		shouldStop := foundCount >= targetCount
+	}()
 
-		// result sent_epoch
-		var resultSentUs *int64
-		if v, ok := obj[measureCfg.T0Field]; ok && v != nil {
-			x, e := parseFieldToEpoch(v, measureCfg.T0Unit)
-			if e == nil {
-				resultSentUs = x
-			}
-		}
-		rec.ResultSentUs = resultSentUs
-		if resultSentUs == nil {
-			badCount++
-			rec.Error = "missing_or_bad_" + measureCfg.T0Field
-			b, _ := json.Marshal(rec)
-			w.Write(b)
-			w.WriteByte('\n')
-			logRecord(rec)
-			if shouldStop {
-				stopReason = "all-found"
-				measureLogger.Printf("[STOP] all_messages_found=%d", foundCount)
-				break
-			}
-			continue
-		}
+	// Интерактивная панель вместо потока [RECORD].
+	stopDashboard := func() {}
+	if measureCfg.TUI {
+		coll.dash = newDashboardState(measureCfg.HistPrecision, sourceIndex)
+		stopDashboard = startDashboard(&dashboard{
+			coll:      coll,
+			rdb:       rdb,
+			obsQueue:  measureCfg.ObsQueue,
+			holdQueue: hq,
+			startUs:   startUs,
+			endUs:     endUs,
+		})
+	}
 
-		sourceRec, ok := sourceIndex[msgID]
-		if !ok {
-			badCount++
-			rec.Error = "source_not_found"
-			b, _ := json.Marshal(rec)
-			w.Write(b)
-			w.WriteByte('\n')
-			logRecord(rec)
-			if shouldStop {
-				stopReason = "all-found"
-				measureLogger.Printf("[STOP] all_messages_found=%d", foundCount)
-				break
-			}
-			continue
-		}
-		sourceSentUs := sourceRec.SentUs
-		rec.SourceSentUs = &sourceSentUs
-
-		serveUs := *resultSentUs - sourceSentUs
-		if serveUs < 0 {
-			badCount++
-			rec.Error = "result_sent_before_source"
-			b, _ := json.Marshal(rec)
-			w.Write(b)
-			w.WriteByte('\n')
-			logRecord(rec)
-			if shouldStop {
-				stopReason = "all-found"
-				measureLogger.Printf("[STOP] all_messages_found=%d", foundCount)
-				break
-			}
-			continue
-		}
+	// Параллельные потребители: каждый блокируется на своем BRPOPLPUSH.
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for i := 0; i < consumers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !coll.stopped() {
+				if internal.NowMicros() >= endUs {
+					coll.stop("timeout")
+					return
+				}
+
+				// Atomic move obs -> hold
+				raw, err := rdb.BRPopLPush(ctx, measureCfg.ObsQueue, hq, time.Duration(measureCfg.BlockSec)*time.Second).Result()
+				if err != nil {
+					if err == redis.Nil {
+						continue // timeout, queue empty
+					}
+					errOnce.Do(func() { firstErr = fmt.Errorf("brpoplpush: %w", err) })
+					coll.stop("error")
+					return
+				}
 
-		lat := ts - *resultSentUs
-		if lat < 0 {
-			badCount++
-			rec.Error = "result_sent_in_future"
-			b, _ := json.Marshal(rec)
-			w.Write(b)
-			w.WriteByte('\n')
-			logRecord(rec)
-			if shouldStop {
-				stopReason = "all-found"
-				measureLogger.Printf("[STOP] all_messages_found=%d", foundCount)
-				break
+				ts := internal.NowMicros()
+				rec := buildRecord([]byte(raw), ts, measureCfg, sourceIndex, traceIndex, extraFields, stages)
+				coll.observe(rec, ts)
 			}
-			continue
+		}()
+	}
+	wg.Wait()
+	close(tickDone)
+	<-tickStopped
+	stopDashboard()
+	if firstErr != nil {
+		return firstErr
+	}
+	if coll.exportErr != nil {
+		return coll.exportErr
+	}
+	for _, e := range exporters {
+		if err := e.Close(); err != nil {
+			return err
 		}
+		measureLogger.Printf("[EXPORT] path=%s", e.Path())
+	}
 
-		rec.OK = true
-		rec.ServeUs = &serveUs
-		rec.LatencyUs = &lat
-		okCount++
-		serveTimes = append(serveTimes, serveUs)
-		latencies = append(latencies, lat)
-
-		b, _ := json.Marshal(rec)
-		w.Write(b)
-		w.WriteByte('\n')
-		logRecord(rec)
+	total, okCount, badCount := coll.total, coll.okCount, coll.badCount
+	foundCount := coll.foundCount
+	found := coll.found
+	stopReason := coll.stopReason
 
-		if shouldStop {
-			stopReason = "all-found"
-			measureLogger.Printf("[STOP] all_messages_found=%d", foundCount)
-			break
-		}
-	}
 	if stopReason == "timeout" && foundCount < targetCount {
 		measureLogger.Printf("[WARN] timeout before all dump messages were found: messages_received=%d messages_in_dump=%d missing=%d timeout_sec=%d total_read=%d",
 			foundCount, targetCount, targetCount-foundCount, measureCfg.DurationSec, total)
@@ -615,54 +950,119 @@ func RunMeasureListLatency(cfg *config.Config) error {
 	if durS <= 0 {
 		durS = 1e-9
 	}
-	// Итоговая статистика.
-	throughput := float64(okCount) / durS
-	measureLogger.Printf("[RESULT] total_read=%d ok=%d bad=%d duration_s=%.3f ok_throughput_msg_s=%.3f",
-		total, okCount, badCount, durS, throughput)
+	// Итоговая статистика; временные окна исключения не входят в throughput.
+	statsDurS := durS - coll.window.excludedDurationSec(startUs, startUs+int64(durS*1_000_000))
+	if statsDurS <= 0 {
+		statsDurS = 1e-9
+	}
+	throughput := float64(okCount) / statsDurS
+	throughputBytes := float64(coll.okBytes) / statsDurS
+	measureLogger.Printf("[RESULT] total_read=%d ok=%d bad=%d duration_s=%.3f ok_throughput_msg_s=%.3f ok_throughput_bytes_s=%.0f",
+		total, okCount, badCount, durS, throughput, throughputBytes)
 
+	serveStats := summarizeHistogram(coll.serveHist, quantiles, measureCfg.StatsHistogram)
+	latStats := summarizeHistogram(coll.latHist, quantiles, measureCfg.StatsHistogram)
+	processStats := summarizeHistogram(coll.processHist, quantiles, measureCfg.StatsHistogram)
+	for _, reason := range []string{windowWarmup, windowCooldown} {
+		if g := coll.excluded[reason]; g != nil {
+			measureLogger.Printf("[EXCLUDED] window=%s count=%d ok=%d bad=%d", reason, g.count, g.okCount, g.badCount)
+		}
+	}
+	logDistribution("SERVE", serveStats)
+	logDistribution("LAT", latStats)
 	var (
-		serveStats *percentileStats
-		latStats   *percentileStats
+		groupBy []string
+		groups  map[string]*groupStats
 	)
-	if okCount > 0 {
-		sort.Slice(serveTimes, func(i, j int) bool { return serveTimes[i] < serveTimes[j] })
-		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
-		serveStats = &percentileStats{
-			P50: percentile(serveTimes, 0.50),
-			P90: percentile(serveTimes, 0.90),
-			P95: percentile(serveTimes, 0.95),
-			P99: percentile(serveTimes, 0.99),
-		}
-		latStats = &percentileStats{
-			P50: percentile(latencies, 0.50),
-			P90: percentile(latencies, 0.90),
-			P95: percentile(latencies, 0.95),
-			P99: percentile(latencies, 0.99),
-		}
-		measureLogger.Printf("[SERVE] p50=%d us", serveStats.P50)
-		measureLogger.Printf("[SERVE] p90=%d us", serveStats.P90)
-		measureLogger.Printf("[SERVE] p95=%d us", serveStats.P95)
-		measureLogger.Printf("[SERVE] p99=%d us", serveStats.P99)
-		measureLogger.Printf("[SERVE] max=%d us", serveTimes[len(serveTimes)-1])
-		measureLogger.Printf("[LAT] p50=%d us", latStats.P50)
-		measureLogger.Printf("[LAT] p90=%d us", latStats.P90)
-		measureLogger.Printf("[LAT] p95=%d us", latStats.P95)
-		measureLogger.Printf("[LAT] p99=%d us", latStats.P99)
-		measureLogger.Printf("[LAT] max=%d us", latencies[len(latencies)-1])
+	if coll.groups != nil {
+		coll.groups.countLost(sourceIndex, lostIDs)
+		groupBy = coll.groups.columns()
+		groups = coll.groups.summary(quantiles, statsDurS)
+		logGroups(groups)
+	}
+	var (
+		sizeBy      string
+		sizeBuckets []sizeBucketStats
+	)
+	if coll.sizes != nil {
+		sizeBy = coll.sizes.by
+		sizeBuckets = coll.sizes.summary(quantiles, statsDurS)
+		logSizeBuckets(measureCfg.SizeBucketBy, sizeBuckets)
+	}
+	var stagesStats *stagesSummary
+	if coll.stages != nil {
+		stagesStats = coll.stages.summary(quantiles)
+		logStages(stagesStats)
+	}
+	if processStats != nil {
+		measureLogger.Printf("[PROC] consumers=%d p50=%d us p99=%d us max=%d us",
+			consumers, processStats.P50, processStats.P99, processStats.Max)
 	}
 	statsJSONPath := buildStatsJSONPath(measureCfg.OutJSONL)
-	if err := writeStatsJSON(statsJSONPath, measureStatsFile{
-		TotalRead:        total,
-		OK:               okCount,
-		Bad:              badCount,
-		DurationSec:      durS,
-		OKThroughputMsgS: throughput,
-		ServeUs:          serveStats,
-		LatencyUs:        latStats,
-	}); err != nil {
+	statsFile := measureStatsFile{
+		TotalRead:          total,
+		OK:                 okCount,
+		Bad:                badCount,
+		DurationSec:        durS,
+		OKThroughputMsgS:   throughput,
+		OKThroughputBytesS: throughputBytes,
+		MessagesInDump:     targetCount,
+		Lost:               len(lostMessages),
+		LostRatio:          float64(len(lostMessages)) / float64(targetCount),
+		ServeUs:            serveStats,
+		LatencyUs:          latStats,
+		ProcessUs:          processStats,
+		Consumers:          consumers,
+		Warmup:             coll.excluded[windowWarmup].summary(quantiles),
+		Cooldown:           coll.excluded[windowCooldown].summary(quantiles),
+		GroupBy:            groupBy,
+		Groups:             groups,
+		SizeBucketBy:       sizeBy,
+		SizeBuckets:        sizeBuckets,
+		Stages:             stagesStats,
+		Run: map[string]string{
+			"started_at":        time.UnixMicro(startUs).UTC().Format(time.RFC3339),
+			"stop_reason":       stopReason,
+			"obs_queue":         measureCfg.ObsQueue,
+			"hold_queue":        hq,
+			"source_dump":       measureCfg.SourceDump,
+			"message_id_field":  measureCfg.MessageIDField,
+			"source_sent_field": measureCfg.SourceSentField,
+			"t0_field":          measureCfg.T0Field,
+			"correlate_by":      measureCfg.CorrelateBy,
+			"duration_sec":      strconv.Itoa(measureCfg.DurationSec),
+			"consumers":         strconv.Itoa(consumers),
+			"series_interval":   cfg.SeriesInterval.String(),
+			"out_jsonl":         measureCfg.OutJSONL,
+		},
+	}
+	if err := writeStatsJSON(statsJSONPath, statsFile); err != nil {
 		return err
 	}
 	measureLogger.Printf("[STATS] path=%s", statsJSONPath)
+	// Ошибка отправки не должна пропускать восстановление, SLO и JUnit: возвращается в конце.
+	pushCtx, pushCancel := context.WithTimeout(ctx, cfg.Timeout)
+	pushErr := pushStats(pushCtx, cfg.Push, statsFile)
+	pushCancel()
+	if pushErr != nil {
+		measureLogger.Printf("[WARN] %v", pushErr)
+	}
+	if seriesOut != nil {
+		coll.mu.Lock()
+		coll.series.finish(internal.NowMicros())
+		coll.mu.Unlock()
+		if err := seriesOut.Close(); err != nil {
+			return err
+		}
+		measureLogger.Printf("[SERIES] path=%s interval=%s", buildTimeseriesPath(measureCfg.OutJSONL), cfg.SeriesInterval)
+	}
+	if measureCfg.HTMLReport {
+		htmlPath := buildHTMLReportPath(statsJSONPath)
+		if err := writeHTMLReport(htmlPath, statsJSONPath, buildTimeseriesPath(measureCfg.OutJSONL), "lost.json"); err != nil {
+			return err
+		}
+		measureLogger.Printf("[HTML] path=%s", htmlPath)
+	}
 
 	// Опциональное восстановление сообщений.
 	if measureCfg.Restore {
@@ -692,5 +1092,29 @@ func RunMeasureListLatency(cfg *config.Config) error {
 		}
 		measureLogger.Printf("[RESTORE] moved_back=%d from %s -> %s", moved, hq, measureCfg.ObsQueue)
 	}
-	return nil
+
+	// SLO-проверки по итоговой статистике.
+	var (
+		sloResults []sloResult
+		violation  error
+	)
+	if len(sloChecks) > 0 {
+		sloResults = evaluateSLO(sloChecks, statsFile)
+		violation = sloViolation(sloResults)
+		failed := 0
+		if v, ok := violation.(*SLOViolationError); ok {
+			failed = v.Failed
+		}
+		measureLogger.Printf("[SLO] checks=%d failed=%d", len(sloResults), failed)
+		fmt.Print(formatSLOTable(sloResults))
+	}
+	if measureCfg.JUnit != "" {
+		suite := measureJUnitSuite(junitScenarioName(cfg.Push.Scenario, measureCfg.OutJSONL), statsFile, measureCfg.JUnitMaxLostRatio, sloResults)
+		if err := writeJUnit(measureCfg.JUnit, suite); err != nil {
+			return err
+		}
+		measureLogger.Printf("[JUNIT] path=%s tests=%d failures=%d", measureCfg.JUnit, suite.Tests, suite.Failures)
+	}
+	// Нарушение SLO определяет код выхода (3) и при неудачной отправке.
+	return errors.Join(violation, pushErr)
 }
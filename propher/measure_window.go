@@ -0,0 +1,193 @@
+package propher
+
+import (
+	"encoding/json"
+	"fmt"
+	"propher/internal/config"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	windowWarmup   = "warmup"
+	windowCooldown = "cooldown"
+)
+
+// exclusionWindow решает, попадает ли запись в основную статистику.
+// Исключенные записи по-прежнему пишутся в JSONL с пометкой окна.
+type exclusionWindow struct {
+	warmupUntilUs  int64
+	cooldownFromUs int64
+	sentFromUs     *int64
+	sentToUs       *int64
+	// edgeIDs - первые/последние N сообщений источника по sent_epoch.
+	edgeIDs map[string]string
+}
+
+// windowStats - статистика записей, попавших в окно исключения.
+type windowStats struct {
+	Count     int                `json:"count"`
+	OK        int                `json:"ok"`
+	Bad       int                `json:"bad"`
+	ServeUs   *distributionStats `json:"serve_us,omitempty"`
+	LatencyUs *distributionStats `json:"latency_us,omitempty"`
+}
+
+// windowGroup накапливает записи одного окна исключения.
+type windowGroup struct {
+	count     int
+	okCount   int
+	badCount  int
+	serveHist *hdrHistogram
+	latHist   *hdrHistogram
+}
+
+func newWindowGroup(digits int) *windowGroup {
+	return &windowGroup{
+		serveHist: newHDRHistogram(digits),
+		latHist:   newHDRHistogram(digits),
+	}
+}
+
+func (g *windowGroup) observe(rec Record) {
+	g.count++
+	if rec.OK {
+		g.okCount++
+		g.serveHist.Record(*rec.ServeUs)
+		g.latHist.Record(*rec.LatencyUs)
+	} else {
+		g.badCount++
+	}
+}
+
+func (g *windowGroup) summary(quantiles []float64) *windowStats {
+	if g == nil || g.count == 0 {
+		return nil
+	}
+	return &windowStats{
+		Count:     g.count,
+		OK:        g.okCount,
+		Bad:       g.badCount,
+		ServeUs:   summarizeHistogram(g.serveHist, quantiles, false),
+		LatencyUs: summarizeHistogram(g.latHist, quantiles, false),
+	}
+}
+
+// newExclusionWindow строит окна исключения; nil, если ничего не задано.
+func newExclusionWindow(measureCfg config.MeasureListLatencyConfig, startUs int64, sourceIndex map[string]sourceRecord) (*exclusionWindow, error) {
+	if measureCfg.WarmupSec < 0 || measureCfg.CooldownSec < 0 {
+		return nil, fmt.Errorf("warmup-sec and cooldown-sec must be non-negative")
+	}
+	if measureCfg.WarmupCount < 0 || measureCfg.CooldownCount < 0 {
+		return nil, fmt.Errorf("warmup-count and cooldown-count must be non-negative")
+	}
+	w := &exclusionWindow{}
+	enabled := false
+	if measureCfg.WarmupSec > 0 {
+		w.warmupUntilUs = startUs + int64(measureCfg.WarmupSec)*1_000_000
+		enabled = true
+	}
+	if measureCfg.CooldownSec > 0 {
+		if measureCfg.CooldownSec >= measureCfg.DurationSec {
+			return nil, fmt.Errorf("cooldown-sec must be less than duration-sec")
+		}
+		w.cooldownFromUs = startUs + int64(measureCfg.DurationSec-measureCfg.CooldownSec)*1_000_000
+		enabled = true
+	}
+	if s := strings.TrimSpace(measureCfg.StatsSentFrom); s != "" {
+		v, err := parseEpochFlag(s, measureCfg.SourceSentUnit)
+		if err != nil {
+			return nil, fmt.Errorf("stats-sent-from: %w", err)
+		}
+		w.sentFromUs = v
+		enabled = true
+	}
+	if s := strings.TrimSpace(measureCfg.StatsSentTo); s != "" {
+		v, err := parseEpochFlag(s, measureCfg.SourceSentUnit)
+		if err != nil {
+			return nil, fmt.Errorf("stats-sent-to: %w", err)
+		}
+		w.sentToUs = v
+		enabled = true
+	}
+	if measureCfg.WarmupCount > 0 || measureCfg.CooldownCount > 0 {
+		// Ранжируем источник по sent_epoch, при равенстве - по message_id.
+		ids := make([]string, 0, len(sourceIndex))
+		for id := range sourceIndex {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			a, b := sourceIndex[ids[i]].SentUs, sourceIndex[ids[j]].SentUs
+			if a != b {
+				return a < b
+			}
+			return ids[i] < ids[j]
+		})
+		w.edgeIDs = make(map[string]string, measureCfg.WarmupCount+measureCfg.CooldownCount)
+		for i := 0; i < measureCfg.WarmupCount && i < len(ids); i++ {
+			w.edgeIDs[ids[i]] = windowWarmup
+		}
+		for i := 0; i < measureCfg.CooldownCount && i < len(ids); i++ {
+			id := ids[len(ids)-1-i]
+			if _, ok := w.edgeIDs[id]; !ok {
+				w.edgeIDs[id] = windowCooldown
+			}
+		}
+		enabled = true
+	}
+	if !enabled {
+		return nil, nil
+	}
+	return w, nil
+}
+
+// parseEpochFlag разбирает значение флага: число в единицах unit или ISO-строку.
+func parseEpochFlag(s, unit string) (*int64, error) {
+	if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return parseFieldToEpoch(json.Number(s), unit)
+	}
+	return parseFieldToEpoch(s, unit)
+}
+
+// classify возвращает имя окна исключения или пустую строку.
+func (w *exclusionWindow) classify(rec Record, readUs int64) string {
+	if w == nil {
+		return ""
+	}
+	if w.warmupUntilUs > 0 && readUs < w.warmupUntilUs {
+		return windowWarmup
+	}
+	if w.cooldownFromUs > 0 && readUs >= w.cooldownFromUs {
+		return windowCooldown
+	}
+	if rec.SourceSentUs != nil {
+		if w.sentFromUs != nil && *rec.SourceSentUs < *w.sentFromUs {
+			return windowWarmup
+		}
+		if w.sentToUs != nil && *rec.SourceSentUs > *w.sentToUs {
+			return windowCooldown
+		}
+	}
+	if reason, ok := w.edgeIDs[rec.MessageID]; ok {
+		return reason
+	}
+	return ""
+}
+
+// excludedDurationSec возвращает длительность временных окон внутри прогона.
+func (w *exclusionWindow) excludedDurationSec(startUs, nowUs int64) float64 {
+	if w == nil {
+		return 0
+	}
+	var excluded int64
+	if w.warmupUntilUs > 0 {
+		excluded += min(w.warmupUntilUs, nowUs) - startUs
+	}
+	if w.cooldownFromUs > 0 {
+		if from := max(w.cooldownFromUs, w.warmupUntilUs, startUs); nowUs > from {
+			excluded += nowUs - from
+		}
+	}
+	return float64(excluded) / 1_000_000.0
+}
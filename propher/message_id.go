@@ -0,0 +1,106 @@
+package propher
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Способы генерации message_id при переписывании дампа.
+const (
+	messageIDKeep     = "keep"
+	messageIDUUID4    = "uuid4"
+	messageIDUUID7    = "uuid7"
+	messageIDCounter  = "counter"
+	messageIDTemplate = "template"
+	// messageIDCounterTemplate - шаблон режима counter.
+	messageIDCounterTemplate = "{run}-{n}"
+)
+
+var messageIDPlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// messageIDGen выдает новые message_id; n - число уже записанных сообщений.
+type messageIDGen struct {
+	mode     string
+	template string
+	run      string
+	n        int64
+}
+
+// newMessageIDGen проверяет режим и шаблон; для keep возвращает nil.
+func newMessageIDGen(mode, template, run string) (*messageIDGen, error) {
+	switch mode {
+	case "", messageIDKeep:
+		return nil, nil
+	case messageIDUUID4, messageIDUUID7:
+	case messageIDCounter:
+		template = messageIDCounterTemplate
+	case messageIDTemplate:
+		for _, ph := range messageIDPlaceholder.FindAllString(template, -1) {
+			switch ph {
+			case "{run}", "{n}", "{orig}":
+			default:
+				return nil, fmt.Errorf("unknown placeholder %s in message-id-template (want {run}, {n}, {orig})", ph)
+			}
+		}
+		// Без номера сообщения шаблон не дает уникальных id.
+		if !strings.Contains(template, "{n}") {
+			return nil, fmt.Errorf("message-id-template must contain {n}")
+		}
+	default:
+		return nil, fmt.Errorf("message-id must be keep, uuid4, uuid7, counter or template")
+	}
+	return &messageIDGen{mode: mode, template: template, run: run}, nil
+}
+
+// next возвращает id следующего сообщения; orig - исходный message_id (может быть пустым).
+// Номер занимает только commit: строка еще может быть отброшена, а в {n} не должно быть пропусков.
+func (g *messageIDGen) next(orig string) string {
+	switch g.mode {
+	case messageIDUUID4:
+		return newUUID4()
+	case messageIDUUID7:
+		return newUUID7(time.Now())
+	}
+	return strings.NewReplacer(
+		"{run}", g.run,
+		"{n}", strconv.FormatInt(g.n+1, 10),
+		"{orig}", orig,
+	).Replace(g.template)
+}
+
+// commit отмечает, что сообщение с id из последнего next записано.
+func (g *messageIDGen) commit() {
+	g.n++
+}
+
+// newUUID4 - случайный UUID версии 4 (RFC 9562).
+func newUUID4() string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], rand.Uint64())
+	binary.BigEndian.PutUint64(b[8:], rand.Uint64())
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return formatUUID(b)
+}
+
+// newUUID7 - UUID версии 7: 48 бит миллисекунд unix-времени и случайная часть,
+// поэтому id сортируются по времени генерации.
+func newUUID7(now time.Time) string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[8:], rand.Uint64())
+	binary.BigEndian.PutUint64(b[:8], uint64(now.UnixMilli())<<16|rand.Uint64()&0xffff)
+	b[6] = b[6]&0x0f | 0x70
+	b[8] = b[8]&0x3f | 0x80
+	return formatUUID(b)
+}
+
+func formatUUID(b [16]byte) string {
+	h := hex.EncodeToString(b[:])
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
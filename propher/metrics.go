@@ -0,0 +1,191 @@
+package propher
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Границы бакетов Prometheus-гистограмм, микросекунды.
+var promBucketsUs = []float64{
+	100, 250, 500, 1_000, 2_500, 5_000, 10_000, 25_000, 50_000,
+	100_000, 250_000, 500_000, 1_000_000, 2_500_000, 5_000_000, 10_000_000,
+}
+
+// promCounterVec - счетчик с одной меткой.
+type promCounterVec struct {
+	mu     sync.Mutex
+	label  string
+	values map[string]int64
+}
+
+func newPromCounterVec(label string) *promCounterVec {
+	return &promCounterVec{label: label, values: make(map[string]int64)}
+}
+
+func (c *promCounterVec) Add(value string, n int64) {
+	c.mu.Lock()
+	c.values[value] += n
+	c.mu.Unlock()
+}
+
+func (c *promCounterVec) write(w io.Writer, name, help string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, c.label, k, c.values[k])
+	}
+}
+
+// promHistogram - накопительная гистограмма в формате Prometheus.
+type promHistogram struct {
+	mu     sync.Mutex
+	counts []int64
+	sum    float64
+	count  int64
+}
+
+func newPromHistogram() *promHistogram {
+	return &promHistogram{counts: make([]int64, len(promBucketsUs))}
+}
+
+func (h *promHistogram) Observe(v int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	idx := sort.SearchFloat64s(promBucketsUs, float64(v))
+	if idx < len(h.counts) {
+		h.counts[idx]++
+	}
+	h.sum += float64(v)
+	h.count++
+}
+
+func (h *promHistogram) write(w io.Writer, name, help string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	var cum int64
+	for i, le := range promBucketsUs {
+		cum += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(le, 'f', -1, 64), cum)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, strconv.FormatFloat(h.sum, 'f', -1, 64))
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+// runMetrics - живые метрики загрузки и измерения.
+type runMetrics struct {
+	// enabled - листенер поднят; без него метрики с мьютексами не обновляются.
+	enabled       atomic.Bool
+	pushed        *promCounterVec
+	badLines      atomic.Int64
+	recordsRead   atomic.Int64
+	recordsOK     atomic.Int64
+	recordsBad    *promCounterVec
+	excluded      *promCounterVec
+	foundMessages atomic.Int64
+	targetMsgs    atomic.Int64
+	serveUs       *promHistogram
+	latencyUs     *promHistogram
+}
+
+func newRunMetrics() *runMetrics {
+	return &runMetrics{
+		pushed:     newPromCounterVec("transport"),
+		recordsBad: newPromCounterVec("reason"),
+		excluded:   newPromCounterVec("window"),
+		serveUs:    newPromHistogram(),
+		latencyUs:  newPromHistogram(),
+	}
+}
+
+// liveMetrics обновляется, когда поднят HTTP-листенер по -metrics-addr.
+var liveMetrics = newRunMetrics()
+
+// observeRecord учитывает запись измерения.
+func (m *runMetrics) observeRecord(rec Record) {
+	if !m.enabled.Load() {
+		return
+	}
+	m.recordsRead.Add(1)
+	if rec.Excluded != "" {
+		m.excluded.Add(rec.Excluded, 1)
+	}
+	if !rec.OK {
+		m.recordsBad.Add(errorReason(rec.Error), 1)
+		return
+	}
+	m.recordsOK.Add(1)
+	m.serveUs.Observe(*rec.ServeUs)
+	m.latencyUs.Observe(*rec.LatencyUs)
+}
+
+// observePushed учитывает отправленное сообщение.
+func (m *runMetrics) observePushed(transport string) {
+	if m.enabled.Load() {
+		m.pushed.Add(transport, 1)
+	}
+}
+
+// errorReason отбрасывает детали ошибки, чтобы не раздувать кардинальность меток.
+func errorReason(msg string) string {
+	reason, _, _ := strings.Cut(msg, ":")
+	if reason == "" {
+		return "unknown"
+	}
+	return reason
+}
+
+// writeText выводит метрики в текстовом формате Prometheus.
+func (m *runMetrics) writeText(w io.Writer) {
+	m.pushed.write(w, "propher_load_pushed_total", "Messages enqueued by the load step.")
+	fmt.Fprintf(w, "# HELP propher_load_bad_lines_total Input dump lines skipped by the load step.\n# TYPE propher_load_bad_lines_total counter\npropher_load_bad_lines_total %d\n", m.badLines.Load())
+	fmt.Fprintf(w, "# HELP propher_measure_records_read_total Records read from the observed queue.\n# TYPE propher_measure_records_read_total counter\npropher_measure_records_read_total %d\n", m.recordsRead.Load())
+	fmt.Fprintf(w, "# HELP propher_measure_records_ok_total Successfully matched records.\n# TYPE propher_measure_records_ok_total counter\npropher_measure_records_ok_total %d\n", m.recordsOK.Load())
+	m.recordsBad.write(w, "propher_measure_records_bad_total", "Records that failed matching, by reason.")
+	m.excluded.write(w, "propher_measure_records_excluded_total", "Records excluded from stats by warm-up/cool-down windows.")
+	fmt.Fprintf(w, "# HELP propher_measure_found_messages Distinct source messages found so far.\n# TYPE propher_measure_found_messages gauge\npropher_measure_found_messages %d\n", m.foundMessages.Load())
+	fmt.Fprintf(w, "# HELP propher_measure_target_messages Messages indexed from the source dump.\n# TYPE propher_measure_target_messages gauge\npropher_measure_target_messages %d\n", m.targetMsgs.Load())
+	m.serveUs.write(w, "propher_measure_serve_us", "Serve time between source and result sent_epoch, microseconds.")
+	m.latencyUs.write(w, "propher_measure_latency_us", "Latency between result sent_epoch and read, microseconds.")
+}
+
+var metricsServerOnce sync.Once
+
+// startMetricsServer поднимает /metrics один раз на процесс (run = load + measure).
+func startMetricsServer(addr string) error {
+	if addr == "" {
+		return nil
+	}
+	var err error
+	metricsServerOnce.Do(func() {
+		var ln net.Listener
+		ln, err = net.Listen("tcp", addr)
+		if err != nil {
+			err = fmt.Errorf("metrics listen: %w", err)
+			return
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+			liveMetrics.writeText(w)
+		})
+		liveMetrics.enabled.Store(true)
+		go http.Serve(ln, mux)
+		measureLogger.Printf("[METRICS] listening on http://%s/metrics", ln.Addr())
+	})
+	return err
+}
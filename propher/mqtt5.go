@@ -0,0 +1,436 @@
+package propher
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"propher/internal/config"
+	"time"
+)
+
+// Минимальный издатель MQTT v5 без внешних зависимостей: CONNECT, PUBLISH с
+// user properties (QoS 0..2) и DISCONNECT. paho.mqtt.golang умеет только 3.1.1.
+
+const (
+	mqttConnect    = 0x10
+	mqttConnack    = 0x20
+	mqttPublish    = 0x30
+	mqttPuback     = 0x40
+	mqttPubrec     = 0x50
+	mqttPubrel     = 0x62
+	mqttPubcomp    = 0x70
+	mqttDisconnect = 0xE0
+
+	mqttPropMaxQoS       = 0x24
+	mqttPropReasonString = 0x1F
+	mqttPropUserProperty = 0x26
+)
+
+// queuePropertyWriter - транспорт, передающий свойства сообщения отдельно от тела.
+type queuePropertyWriter interface {
+	// EnqueueWithProperties добавляет сообщение со свойствами (MQTT v5 user properties).
+	EnqueueWithProperties(ctx context.Context, payload []byte, props [][2]string) error
+}
+
+type mqtt5QueueWriter struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	w       *bufio.Writer
+	topic   string
+	qos     byte
+	retain  bool
+	timeout time.Duration
+	nextID  uint16
+}
+
+// newMQTT5QueueWriter подключается к брокеру по MQTT v5.
+func newMQTT5QueueWriter(cfg *config.Config) (*mqtt5QueueWriter, error) {
+	if cfg.MQTT.Broker == "" {
+		return nil, fmt.Errorf("mqtt-broker is required when mqtt-topic is set")
+	}
+	conn, err := dialMQTT(cfg.MQTT.Broker, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	return newMQTT5QueueWriterConn(conn, cfg)
+}
+
+// newMQTT5QueueWriterConn выполняет CONNECT на готовом соединении; при ошибке закрывает его.
+func newMQTT5QueueWriterConn(conn net.Conn, cfg *config.Config) (*mqtt5QueueWriter, error) {
+	m := &mqtt5QueueWriter{
+		conn:    conn,
+		r:       bufio.NewReader(conn),
+		w:       bufio.NewWriterSize(conn, 64*1024),
+		topic:   cfg.LoadDump.MQTTTopic,
+		qos:     byte(cfg.LoadDump.MQTTQoS),
+		retain:  cfg.LoadDump.MQTTRetain,
+		timeout: cfg.Timeout,
+	}
+	if err := m.connect(cfg.MQTT); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// dialMQTT открывает TCP или TLS соединение по адресу вида tcp://host:port или ssl://host:port.
+func dialMQTT(broker string, timeout time.Duration) (net.Conn, error) {
+	u, err := url.Parse(broker)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("bad mqtt-broker %q", broker)
+	}
+	secure := false
+	switch u.Scheme {
+	case "tcp", "mqtt":
+	case "ssl", "tls", "mqtts":
+		secure = true
+	default:
+		return nil, fmt.Errorf("unsupported mqtt-broker scheme %q for mqtt v5 (want tcp or ssl)", u.Scheme)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		port := "1883"
+		if secure {
+			port = "8883"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	if secure {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: u.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mqtt connect: %w", err)
+	}
+	return conn, nil
+}
+
+func appendMQTTVarint(b []byte, n int) []byte {
+	for {
+		c := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+func appendMQTTString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func (m *mqtt5QueueWriter) writePacket(header byte, body []byte) error {
+	hdr := appendMQTTVarint([]byte{header}, len(body))
+	if _, err := m.w.Write(hdr); err != nil {
+		return fmt.Errorf("mqtt write: %w", err)
+	}
+	if _, err := m.w.Write(body); err != nil {
+		return fmt.Errorf("mqtt write: %w", err)
+	}
+	return nil
+}
+
+func (m *mqtt5QueueWriter) readPacket() (byte, []byte, error) {
+	header, err := m.r.ReadByte()
+	if err != nil {
+		return 0, nil, fmt.Errorf("mqtt read: %w", err)
+	}
+	n, mul := 0, 1
+	for i := 0; ; i++ {
+		c, err := m.r.ReadByte()
+		if err != nil {
+			return 0, nil, fmt.Errorf("mqtt read: %w", err)
+		}
+		n += int(c&0x7F) * mul
+		if c&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, fmt.Errorf("mqtt read: bad remaining length")
+		}
+		mul *= 128
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(m.r, body); err != nil {
+		return 0, nil, fmt.Errorf("mqtt read: %w", err)
+	}
+	return header, body, nil
+}
+
+// mqttProps - разобранные свойства ответа брокера, которые нужны издателю.
+type mqttProps struct {
+	maxQoS       *byte
+	reasonString string
+}
+
+// parseMQTTProps разбирает блок свойств: длина и сами свойства.
+func parseMQTTProps(b []byte) (mqttProps, error) {
+	var props mqttProps
+	n, size := binary.Uvarint(b)
+	if size <= 0 || int(n) > len(b)-size {
+		return props, fmt.Errorf("mqtt: bad properties length")
+	}
+	p := b[size : size+int(n)]
+	for len(p) > 0 {
+		id := p[0]
+		p = p[1:]
+		var width int
+		switch id {
+		case 0x01, 0x17, 0x19, 0x24, 0x25, 0x28, 0x29, 0x2A:
+			width = 1
+		case 0x13, 0x21, 0x22, 0x23:
+			width = 2
+		case 0x02, 0x11, 0x18, 0x27:
+			width = 4
+		case 0x0B:
+			_, vs := binary.Uvarint(p)
+			width = vs
+		case 0x03, 0x08, 0x09, 0x12, 0x15, 0x16, 0x1A, 0x1C, 0x1F:
+			if len(p) < 2 {
+				return props, fmt.Errorf("mqtt: truncated property 0x%02x", id)
+			}
+			width = 2 + int(binary.BigEndian.Uint16(p))
+		case mqttPropUserProperty:
+			if len(p) < 2 {
+				return props, fmt.Errorf("mqtt: truncated user property")
+			}
+			k := 2 + int(binary.BigEndian.Uint16(p))
+			if len(p) < k+2 {
+				return props, fmt.Errorf("mqtt: truncated user property")
+			}
+			width = k + 2 + int(binary.BigEndian.Uint16(p[k:]))
+		default:
+			return props, fmt.Errorf("mqtt: unknown property 0x%02x", id)
+		}
+		if width <= 0 || width > len(p) {
+			return props, fmt.Errorf("mqtt: truncated property 0x%02x", id)
+		}
+		switch id {
+		case mqttPropMaxQoS:
+			q := p[0]
+			props.maxQoS = &q
+		case mqttPropReasonString:
+			props.reasonString = string(p[2:width])
+		}
+		p = p[width:]
+	}
+	return props, nil
+}
+
+// mqttReasonError описывает код причины >= 0x80 вместе с reason string брокера.
+func mqttReasonError(op string, code byte, props []byte) error {
+	msg := fmt.Sprintf("%s: reason code 0x%02x", op, code)
+	if len(props) > 0 {
+		if p, err := parseMQTTProps(props); err == nil && p.reasonString != "" {
+			msg += ": " + p.reasonString
+		}
+	}
+	return fmt.Errorf("%s", msg)
+}
+
+func (m *mqtt5QueueWriter) connect(mqttCfg config.MQTTConfig) error {
+	body := appendMQTTString(nil, "MQTT")
+	flags := byte(0x02) // clean start
+	if mqttCfg.Username != "" {
+		flags |= 0x80
+	}
+	if mqttCfg.Password != "" {
+		flags |= 0x40
+	}
+	// Keep alive 0: издатель не простаивает, PINGREQ не нужен.
+	body = append(body, 5, flags, 0, 0, 0)
+	body = appendMQTTString(body, mqttCfg.ClientID)
+	if mqttCfg.Username != "" {
+		body = appendMQTTString(body, mqttCfg.Username)
+	}
+	if mqttCfg.Password != "" {
+		body = appendMQTTString(body, mqttCfg.Password)
+	}
+
+	m.conn.SetDeadline(time.Now().Add(m.timeout))
+	defer m.conn.SetDeadline(time.Time{})
+	if err := m.writePacket(mqttConnect, body); err != nil {
+		return err
+	}
+	if err := m.w.Flush(); err != nil {
+		return fmt.Errorf("mqtt connect: %w", err)
+	}
+	header, ack, err := m.readPacket()
+	if err != nil {
+		return fmt.Errorf("mqtt connect: %w", err)
+	}
+	if header != mqttConnack || len(ack) < 2 {
+		return fmt.Errorf("mqtt connect: unexpected packet 0x%02x", header)
+	}
+	if ack[1] >= 0x80 {
+		return mqttReasonError("mqtt connect", ack[1], ack[2:])
+	}
+	if len(ack) > 2 {
+		props, err := parseMQTTProps(ack[2:])
+		if err != nil {
+			return err
+		}
+		if props.maxQoS != nil && m.qos > *props.maxQoS {
+			return fmt.Errorf("mqtt connect: broker maximum QoS is %d, mqtt-qos is %d", *props.maxQoS, m.qos)
+		}
+	}
+	return nil
+}
+
+// waitAck читает пакеты до подтверждения с нужным типом и идентификатором.
+func (m *mqtt5QueueWriter) waitAck(want byte, id uint16) error {
+	for {
+		header, body, err := m.readPacket()
+		if err != nil {
+			return err
+		}
+		switch {
+		case header == mqttDisconnect:
+			code := byte(0)
+			if len(body) > 0 {
+				code = body[0]
+			}
+			return mqttReasonError("mqtt disconnected by broker", code, body[min(1, len(body)):])
+		case header == want && len(body) >= 2 && binary.BigEndian.Uint16(body) == id:
+			if len(body) > 2 && body[2] >= 0x80 {
+				return mqttReasonError("mqtt publish", body[2], body[3:])
+			}
+			return nil
+		}
+	}
+}
+
+func (m *mqtt5QueueWriter) packetID() uint16 {
+	m.nextID++
+	if m.nextID == 0 {
+		m.nextID = 1
+	}
+	return m.nextID
+}
+
+// withDeadline выполняет операцию со сроком timeout, но не позже срока ctx;
+// отмена ctx прерывает ожидание ввода-вывода, и возвращается ошибка ctx.
+func (m *mqtt5QueueWriter) withDeadline(ctx context.Context, op string, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	deadline := time.Now().Add(m.timeout)
+	ctxDeadline := false
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline, ctxDeadline = d, true
+	}
+	m.conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { m.conn.SetDeadline(time.Unix(1, 0)) })
+	err := fn()
+	stop()
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s: %w", op, ctx.Err())
+	}
+	// Таймер соединения может сработать раньше таймера ctx.
+	if ctxDeadline && errors.Is(err, os.ErrDeadlineExceeded) {
+		return fmt.Errorf("%s: %w", op, context.DeadlineExceeded)
+	}
+	return err
+}
+
+// EnqueueWithProperties публикует сообщение с user properties.
+// QoS 0 копится в буфере до Flush, QoS 1/2 ждут подтверждения брокера.
+func (m *mqtt5QueueWriter) EnqueueWithProperties(ctx context.Context, payload []byte, props [][2]string) error {
+	return m.withDeadline(ctx, "mqtt publish", func() error {
+		return m.publish(payload, props)
+	})
+}
+
+func (m *mqtt5QueueWriter) publish(payload []byte, props [][2]string) error {
+	body := appendMQTTString(nil, m.topic)
+	var id uint16
+	if m.qos > 0 {
+		id = m.packetID()
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	var pb []byte
+	for _, kv := range props {
+		pb = append(pb, mqttPropUserProperty)
+		pb = appendMQTTString(pb, kv[0])
+		pb = appendMQTTString(pb, kv[1])
+	}
+	body = appendMQTTVarint(body, len(pb))
+	body = append(body, pb...)
+	body = append(body, payload...)
+
+	header := byte(mqttPublish) | m.qos<<1
+	if m.retain {
+		header |= 0x01
+	}
+	if err := m.writePacket(header, body); err != nil {
+		return err
+	}
+	if m.qos == 0 {
+		return nil
+	}
+	if err := m.w.Flush(); err != nil {
+		return fmt.Errorf("mqtt publish: %w", err)
+	}
+	if m.qos == 1 {
+		return m.waitAck(mqttPuback, id)
+	}
+	if err := m.waitAck(mqttPubrec, id); err != nil {
+		return err
+	}
+	if err := m.writePacket(mqttPubrel, binary.BigEndian.AppendUint16(nil, id)); err != nil {
+		return err
+	}
+	if err := m.w.Flush(); err != nil {
+		return fmt.Errorf("mqtt publish: %w", err)
+	}
+	return m.waitAck(mqttPubcomp, id)
+}
+
+// Enqueue публикует сообщение без свойств.
+func (m *mqtt5QueueWriter) Enqueue(ctx context.Context, payload []byte) error {
+	return m.EnqueueWithProperties(ctx, payload, nil)
+}
+
+// Flush отправляет накопленные публикации QoS 0.
+func (m *mqtt5QueueWriter) Flush(ctx context.Context) error {
+	return m.withDeadline(ctx, "mqtt flush", func() error {
+		if err := m.w.Flush(); err != nil {
+			return fmt.Errorf("mqtt flush: %w", err)
+		}
+		return nil
+	})
+}
+
+// Close отправляет DISCONNECT и закрывает соединение; соединение закрывается и при отмененном ctx.
+func (m *mqtt5QueueWriter) Close(ctx context.Context) error {
+	m.withDeadline(ctx, "mqtt disconnect", func() error {
+		if err := m.writePacket(mqttDisconnect, []byte{0}); err != nil {
+			return err
+		}
+		return m.w.Flush()
+	})
+	return m.conn.Close()
+}
+
+// Label возвращает метку логов.
+func (m *mqtt5QueueWriter) Label() string {
+	return "mqtt"
+}
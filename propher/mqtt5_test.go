@@ -0,0 +1,380 @@
+package propher
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"propher/internal/config"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeMQTTBroker - сторона брокера на net.Pipe; кадры читаются тем же кодеком, что и у издателя.
+type fakeMQTTBroker struct {
+	t    *testing.T
+	conn *mqtt5QueueWriter
+}
+
+func newFakeMQTTBroker(t *testing.T, cfg *config.Config) (*fakeMQTTBroker, net.Conn) {
+	t.Helper()
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	b := &fakeMQTTBroker{t: t, conn: &mqtt5QueueWriter{conn: server, r: bufio.NewReader(server), w: bufio.NewWriter(server)}}
+	return b, client
+}
+
+func (b *fakeMQTTBroker) read() (byte, []byte) {
+	header, body, err := b.conn.readPacket()
+	if err != nil {
+		b.t.Errorf("broker read: %v", err)
+		return 0, nil
+	}
+	return header, body
+}
+
+func (b *fakeMQTTBroker) send(header byte, body []byte) {
+	if err := b.conn.writePacket(header, body); err != nil {
+		b.t.Errorf("broker write: %v", err)
+	}
+	if err := b.conn.w.Flush(); err != nil {
+		b.t.Errorf("broker flush: %v", err)
+	}
+}
+
+// mqttPropsBlock собирает блок свойств из готовых свойств (идентификатор и значение).
+func mqttPropsBlock(props ...[]byte) []byte {
+	var p []byte
+	for _, prop := range props {
+		p = append(p, prop...)
+	}
+	return append(appendMQTTVarint(nil, len(p)), p...)
+}
+
+func mqttReasonProp(s string) []byte {
+	return appendMQTTString([]byte{mqttPropReasonString}, s)
+}
+
+// connectPacket - разобранный CONNECT.
+type connectPacket struct {
+	protocol string
+	version  byte
+	flags    byte
+	clientID string
+	username string
+	password string
+}
+
+func mqttReadString(t *testing.T, b []byte) (string, []byte) {
+	t.Helper()
+	if len(b) < 2 || len(b) < 2+int(binary.BigEndian.Uint16(b)) {
+		t.Fatalf("truncated mqtt string")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	return string(b[2 : 2+n]), b[2+n:]
+}
+
+func parseConnect(t *testing.T, body []byte) connectPacket {
+	t.Helper()
+	var c connectPacket
+	c.protocol, body = mqttReadString(t, body)
+	c.version, c.flags = body[0], body[1]
+	body = body[4:] // version, flags, keep alive
+	props, n := binary.Uvarint(body)
+	body = body[n+int(props):]
+	c.clientID, body = mqttReadString(t, body)
+	if c.flags&0x80 != 0 {
+		c.username, body = mqttReadString(t, body)
+	}
+	if c.flags&0x40 != 0 {
+		c.password, body = mqttReadString(t, body)
+	}
+	if len(body) != 0 {
+		t.Errorf("CONNECT: %d trailing bytes", len(body))
+	}
+	return c
+}
+
+// publishPacket - разобранный PUBLISH.
+type publishPacket struct {
+	qos     byte
+	retain  bool
+	topic   string
+	id      uint16
+	props   [][2]string
+	payload string
+}
+
+func parsePublish(t *testing.T, header byte, body []byte) publishPacket {
+	t.Helper()
+	p := publishPacket{qos: header >> 1 & 3, retain: header&1 == 1}
+	p.topic, body = mqttReadString(t, body)
+	if p.qos > 0 {
+		p.id = binary.BigEndian.Uint16(body)
+		body = body[2:]
+	}
+	n, size := binary.Uvarint(body)
+	props := body[size : size+int(n)]
+	for len(props) > 0 {
+		if props[0] != mqttPropUserProperty {
+			t.Fatalf("PUBLISH: unexpected property 0x%02x", props[0])
+		}
+		var k, v string
+		k, props = mqttReadString(t, props[1:])
+		v, props = mqttReadString(t, props)
+		p.props = append(p.props, [2]string{k, v})
+	}
+	p.payload = string(body[size+int(n):])
+	return p
+}
+
+func testMQTTConfig(qos int) *config.Config {
+	cfg := &config.Config{Timeout: 5 * time.Second}
+	cfg.MQTT.ClientID = "propher-test"
+	cfg.MQTT.Username = "user"
+	cfg.MQTT.Password = "secret"
+	cfg.LoadDump.MQTTTopic = "in/orders"
+	cfg.LoadDump.MQTTQoS = qos
+	return cfg
+}
+
+func TestMQTTVarint(t *testing.T) {
+	for _, tc := range []struct {
+		n    int
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7F}},
+		{128, []byte{0x80, 0x01}},
+		{16383, []byte{0xFF, 0x7F}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+		{2097152, []byte{0x80, 0x80, 0x80, 0x01}},
+		{268435455, []byte{0xFF, 0xFF, 0xFF, 0x7F}},
+	} {
+		if got := appendMQTTVarint(nil, tc.n); !bytes.Equal(got, tc.want) {
+			t.Errorf("varint(%d) = % x, want % x", tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestMQTT5Publish(t *testing.T) {
+	props := [][2]string{{"traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}, {"tenant", "acme"}}
+	payloads := []string{`{"message_id":"m1"}`, strings.Repeat("x", 300)}
+	for _, qos := range []int{0, 1, 2} {
+		t.Run("qos"+string(rune('0'+qos)), func(t *testing.T) {
+			cfg := testMQTTConfig(qos)
+			cfg.LoadDump.MQTTRetain = qos == 1
+			broker, client := newFakeMQTTBroker(t, cfg)
+
+			var got []publishPacket
+			var connect connectPacket
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				header, body := broker.read()
+				if header != mqttConnect {
+					t.Errorf("first packet 0x%02x, want CONNECT", header)
+					return
+				}
+				connect = parseConnect(t, body)
+				// Свойства CONNACK: Maximum QoS 2, Topic Alias Maximum и незнакомый издателю User Property.
+				broker.send(mqttConnack, append([]byte{0, 0}, mqttPropsBlock(
+					[]byte{mqttPropMaxQoS, 2},
+					[]byte{0x22, 0, 10},
+					appendMQTTString(appendMQTTString([]byte{mqttPropUserProperty}, "k"), "v"),
+				)...))
+				for {
+					header, body := broker.read()
+					switch {
+					case header&0xF0 == mqttPublish:
+						p := parsePublish(t, header, body)
+						got = append(got, p)
+						id := binary.BigEndian.AppendUint16(nil, p.id)
+						switch p.qos {
+						case 1:
+							broker.send(mqttPuback, id)
+						case 2:
+							broker.send(mqttPubrec, id)
+							rel, relBody := broker.read()
+							if rel != mqttPubrel || !bytes.Equal(relBody, id) {
+								t.Errorf("after PUBREC got 0x%02x % x, want PUBREL % x", rel, relBody, id)
+							}
+							// PUBCOMP с кодом причины 0 и пустым блоком свойств.
+							broker.send(mqttPubcomp, append(id, 0, 0))
+						}
+					case header == mqttDisconnect:
+						return
+					default:
+						t.Errorf("unexpected packet 0x%02x", header)
+						return
+					}
+				}
+			}()
+
+			m, err := newMQTT5QueueWriterConn(client, cfg)
+			if err != nil {
+				t.Fatalf("connect: %v", err)
+			}
+			ctx := context.Background()
+			for _, p := range payloads {
+				if err := m.EnqueueWithProperties(ctx, []byte(p), props); err != nil {
+					t.Fatalf("publish: %v", err)
+				}
+			}
+			if err := m.Flush(ctx); err != nil {
+				t.Fatalf("flush: %v", err)
+			}
+			if err := m.Close(ctx); err != nil {
+				t.Fatalf("close: %v", err)
+			}
+			<-done
+
+			want := connectPacket{protocol: "MQTT", version: 5, flags: 0xC2, clientID: "propher-test", username: "user", password: "secret"}
+			if connect != want {
+				t.Errorf("CONNECT = %+v, want %+v", connect, want)
+			}
+			if len(got) != len(payloads) {
+				t.Fatalf("published %d messages, want %d", len(got), len(payloads))
+			}
+			for i, p := range got {
+				if p.topic != "in/orders" || p.qos != byte(qos) || p.retain != (qos == 1) || p.payload != payloads[i] {
+					t.Errorf("message %d = %+v", i, p)
+				}
+				if !reflect.DeepEqual(p.props, props) {
+					t.Errorf("message %d user properties = %v, want %v", i, p.props, props)
+				}
+				if qos > 0 && p.id != uint16(i+1) {
+					t.Errorf("message %d packet id = %d, want %d", i, p.id, i+1)
+				}
+			}
+		})
+	}
+}
+
+// connectWith подключается к брокеру, который отвечает на CONNECT заданным CONNACK.
+func connectWith(t *testing.T, cfg *config.Config, connack []byte) (*mqtt5QueueWriter, *fakeMQTTBroker, error) {
+	t.Helper()
+	broker, client := newFakeMQTTBroker(t, cfg)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		broker.read()
+		broker.send(mqttConnack, connack)
+	}()
+	m, err := newMQTT5QueueWriterConn(client, cfg)
+	// Дальше брокер пишет из другой горутины: эта должна закончить запись.
+	<-done
+	return m, broker, err
+}
+
+func TestMQTT5ConnackErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		qos     int
+		connack []byte
+		want    []string
+	}{
+		{
+			name:    "max qos",
+			qos:     1,
+			connack: append([]byte{0, 0}, mqttPropsBlock([]byte{mqttPropMaxQoS, 0})...),
+			want:    []string{"maximum QoS is 0", "mqtt-qos is 1"},
+		},
+		{
+			name:    "reason string",
+			connack: append([]byte{0, 0x87}, mqttPropsBlock(mqttReasonProp("not authorized"))...),
+			want:    []string{"reason code 0x87", "not authorized"},
+		},
+		{
+			name:    "bad properties",
+			connack: append([]byte{0, 0}, mqttPropsBlock([]byte{0x7F, 1})...),
+			want:    []string{"unknown property 0x7f"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := connectWith(t, testMQTTConfig(tc.qos), tc.connack)
+			if err == nil {
+				t.Fatalf("want error")
+			}
+			for _, w := range tc.want {
+				if !strings.Contains(err.Error(), w) {
+					t.Errorf("error %q does not contain %q", err, w)
+				}
+			}
+		})
+	}
+	// Maximum QoS не ниже mqtt-qos - подключение проходит.
+	m, _, err := connectWith(t, testMQTTConfig(1), append([]byte{0, 0}, mqttPropsBlock([]byte{mqttPropMaxQoS, 1})...))
+	if err != nil {
+		t.Fatalf("max qos 1 with mqtt-qos 1: %v", err)
+	}
+	m.conn.Close()
+}
+
+func TestMQTT5PublishReasonCode(t *testing.T) {
+	m, broker, err := connectWith(t, testMQTTConfig(1), []byte{0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_, body := broker.read()
+		p := parsePublish(t, mqttPublish|2, body)
+		ack := binary.BigEndian.AppendUint16(nil, p.id)
+		broker.send(mqttPuback, append(append(ack, 0x97), mqttPropsBlock(mqttReasonProp("quota exceeded"))...))
+	}()
+	err = m.EnqueueWithProperties(context.Background(), []byte("x"), nil)
+	if err == nil || !strings.Contains(err.Error(), "0x97") || !strings.Contains(err.Error(), "quota exceeded") {
+		t.Errorf("err = %v, want reason 0x97 with reason string", err)
+	}
+}
+
+func TestMQTT5ContextDeadline(t *testing.T) {
+	cfg := testMQTTConfig(1)
+	cfg.Timeout = time.Minute
+	m, broker, err := connectWith(t, cfg, []byte{0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Брокер принимает PUBLISH, но не подтверждает его.
+	go broker.read()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = m.EnqueueWithProperties(ctx, []byte("x"), nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context deadline", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("publish returned after %s, ctx deadline was ignored", d)
+	}
+}
+
+func TestMQTT5ContextCancel(t *testing.T) {
+	cfg := testMQTTConfig(1)
+	cfg.Timeout = time.Minute
+	m, broker, err := connectWith(t, cfg, []byte{0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go broker.read()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if err := m.EnqueueWithProperties(ctx, []byte("x"), nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context canceled", err)
+	}
+	if err := m.Flush(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("flush with canceled ctx: err = %v", err)
+	}
+	if err := m.Close(ctx); err != nil {
+		t.Errorf("close with canceled ctx: %v", err)
+	}
+}
@@ -0,0 +1,282 @@
+package propher
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Операции правил изменения сообщений.
+const (
+	mutateSet    = "set"
+	mutateDelete = "delete"
+	mutateRename = "rename"
+	mutateChoice = "choice"
+	mutateSeq    = "seq"
+	mutateEnv    = "env"
+)
+
+var envPlaceholder = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// mutation - одно правило изменения сообщения.
+type mutation struct {
+	op    string
+	field string
+	// to - новое имя поля для rename.
+	to string
+	// value - готовое JSON-значение для set и env.
+	value []byte
+	// choices - варианты для choice.
+	choices []json.RawMessage
+	// next и step - следующее значение и шаг seq.
+	next, step int64
+}
+
+// mutator применяет правила по порядку; случайный выбор воспроизводим при том же seed.
+// seq и choice продвигаются только в commit, когда сообщение записано: отброшенная
+// строка не занимает номер и не сдвигает выбор.
+type mutator struct {
+	rules []*mutation
+	src   *rand.PCG
+	// pending - состояние генератора после последнего apply.
+	pending rand.PCG
+	rng     *rand.Rand
+	seed    uint64
+}
+
+// expandEnv подставляет ${VAR} из окружения; неустановленная переменная - ошибка.
+func expandEnv(s string) (string, error) {
+	var missing string
+	out := envPlaceholder.ReplaceAllStringFunc(s, func(m string) string {
+		name := m[2 : len(m)-1]
+		v, ok := os.LookupEnv(name)
+		if !ok && missing == "" {
+			missing = name
+		}
+		return v
+	})
+	if missing != "" {
+		return "", fmt.Errorf("env %s is not set", missing)
+	}
+	return out, nil
+}
+
+// expandEnvJSON подставляет ${VAR} во все строковые значения JSON-значения на любой
+// глубине; ключи объектов и остальные байты не меняются.
+func expandEnvJSON(value []byte) ([]byte, error) {
+	var out []byte
+	prev := 0
+	for i := 0; i < len(value); i++ {
+		if value[i] != '"' {
+			continue
+		}
+		end, err := skipJSONString(value, i)
+		if err != nil {
+			return nil, err
+		}
+		j := skipJSONSpace(value, end)
+		isKey := j < len(value) && value[j] == ':'
+		var s string
+		if !isKey && json.Unmarshal(value[i:end], &s) == nil && envPlaceholder.MatchString(s) {
+			expanded, err := expandEnv(s)
+			if err != nil {
+				return nil, err
+			}
+			out = appendJSONString(append(out, value[prev:i]...), expanded)
+			prev = end
+		}
+		i = end - 1
+	}
+	if out == nil {
+		return value, nil
+	}
+	return append(out, value[prev:]...), nil
+}
+
+// cutWord отделяет первое слово строки от остатка.
+func cutWord(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		return s[:i], strings.TrimSpace(s[i:])
+	}
+	return s, ""
+}
+
+// parseMutation разбирает строку правила "<op> <field> [arg]".
+func parseMutation(line string) (*mutation, error) {
+	op, rest := cutWord(line)
+	field, arg := cutWord(rest)
+	m := &mutation{op: op, field: field}
+	if field == "" {
+		return nil, fmt.Errorf("%s: field is required", op)
+	}
+	if err := validateFieldPaths(field); err != nil {
+		return nil, err
+	}
+	switch op {
+	case mutateSet:
+		if !json.Valid([]byte(arg)) {
+			return nil, fmt.Errorf("set %s: value must be JSON, got %q", field, arg)
+		}
+		value, err := expandEnvJSON([]byte(arg))
+		if err != nil {
+			return nil, fmt.Errorf("set %s: %w", field, err)
+		}
+		m.value = value
+	case mutateDelete:
+		if arg != "" {
+			return nil, fmt.Errorf("delete %s: unexpected argument %q", field, arg)
+		}
+		if isFieldPath(field) {
+			if steps, _ := parseFieldPath(field); steps[len(steps)-1].isIndex {
+				return nil, fmt.Errorf("delete %s: array elements cannot be deleted", field)
+			}
+		}
+	case mutateRename:
+		if arg == "" || arg == field {
+			return nil, fmt.Errorf("rename %s: new name is required and must differ", field)
+		}
+		if err := validateFieldPaths(arg); err != nil {
+			return nil, err
+		}
+		m.to = arg
+	case mutateChoice:
+		if err := json.Unmarshal([]byte(arg), &m.choices); err != nil || len(m.choices) == 0 {
+			return nil, fmt.Errorf("choice %s: want a non-empty JSON array, got %q", field, arg)
+		}
+	case mutateSeq:
+		start, step := cutWord(arg)
+		var err error
+		if m.next, err = strconv.ParseInt(start, 10, 64); err != nil {
+			return nil, fmt.Errorf("seq %s: bad start %q", field, start)
+		}
+		m.step = 1
+		if step != "" {
+			if m.step, err = strconv.ParseInt(step, 10, 64); err != nil {
+				return nil, fmt.Errorf("seq %s: bad step %q", field, step)
+			}
+		}
+	case mutateEnv:
+		v, ok := os.LookupEnv(arg)
+		if arg == "" || !ok {
+			return nil, fmt.Errorf("env %s: env %q is not set", field, arg)
+		}
+		m.value = appendJSONString(nil, v)
+	default:
+		return nil, fmt.Errorf("unknown operation %q (want set, delete, rename, choice, seq or env)", op)
+	}
+	return m, nil
+}
+
+// fields - поля правила, которые оно меняет.
+func (r *mutation) fields() []string {
+	if r.op == mutateRename {
+		return []string{r.field, r.to}
+	}
+	return []string{r.field}
+}
+
+// loadMutator читает правила из файла, по одному на строку; # - комментарий.
+// seed 0 выбирает случайный seed, он печатается для повторения прогона. Без файла возвращает nil.
+// reserved - поля, которые пишет сама загрузка: правила не должны их задевать.
+func loadMutator(path string, seed uint64, reserved ...string) (*mutator, error) {
+	if path == "" {
+		return nil, nil
+	}
+	var (
+		reservedSteps [][]pathStep
+		reservedNames []string
+	)
+	for _, f := range reserved {
+		if f == "" {
+			continue
+		}
+		steps, err := parseFieldPath(f)
+		if err != nil {
+			return nil, err
+		}
+		reservedSteps = append(reservedSteps, steps)
+		reservedNames = append(reservedNames, f)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open mutate rules: %w", err)
+	}
+	defer f.Close()
+
+	m := &mutator{seed: seed}
+	scan := bufio.NewScanner(f)
+	for n := 1; scan.Scan(); n++ {
+		line := strings.TrimSpace(scan.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := parseMutation(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		for _, f := range rule.fields() {
+			steps, _ := parseFieldPath(f)
+			for i, r := range reservedSteps {
+				if overlapsPath(steps, r) {
+					return nil, fmt.Errorf("%s:%d: %s %s: field %s is written by the load itself (%s)", path, n, rule.op, rule.field, f, reservedNames[i])
+				}
+			}
+		}
+		m.rules = append(m.rules, rule)
+	}
+	if err := scan.Err(); err != nil {
+		return nil, fmt.Errorf("read mutate rules: %w", err)
+	}
+	if m.seed == 0 {
+		m.seed = rand.Uint64()
+	}
+	m.src = rand.NewPCG(m.seed, 0)
+	m.rng = rand.New(&m.pending)
+	return m, nil
+}
+
+// apply применяет правила к сообщению по порядку; счетчики и генератор не сдвигаются до commit.
+func (m *mutator) apply(doc []byte) ([]byte, error) {
+	m.pending = *m.src
+	var err error
+	for _, r := range m.rules {
+		switch r.op {
+		case mutateSet, mutateEnv:
+			doc, err = setJSONField(doc, r.field, r.value)
+		case mutateDelete:
+			doc, _, err = deleteJSONField(doc, r.field)
+		case mutateRename:
+			raw, ok := getJSONField(doc, r.field)
+			if !ok {
+				continue
+			}
+			if doc, _, err = deleteJSONField(doc, r.field); err == nil {
+				doc, err = setJSONField(doc, r.to, raw)
+			}
+		case mutateChoice:
+			doc, err = setJSONField(doc, r.field, r.choices[m.rng.IntN(len(r.choices))])
+		case mutateSeq:
+			doc, err = setJSONField(doc, r.field, strconv.AppendInt(nil, r.next, 10))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", r.op, r.field, err)
+		}
+	}
+	return doc, nil
+}
+
+// commit отмечает, что сообщение из последнего apply записано.
+func (m *mutator) commit() {
+	*m.src = m.pending
+	for _, r := range m.rules {
+		if r.op == mutateSeq {
+			r.next += r.step
+		}
+	}
+}
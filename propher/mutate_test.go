@@ -0,0 +1,205 @@
+package propher
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestMutator собирает mutator из правил через временный файл.
+func newTestMutator(t *testing.T, seed uint64, lines ...string) *mutator {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rules.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := loadMutator(path, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMutatorOps(t *testing.T) {
+	t.Setenv("PROPHER_TEST_USER", `ann "q"`)
+	t.Setenv("PROPHER_TEST_HOST", "h1")
+	tests := []struct {
+		name, rule, doc, want string
+	}{
+		{"set scalar", `set tenant "load"`, `{"a":1}`, `{"a":1,"tenant":"load"}`},
+		{"set replaces", `set a {"x": [1, 2]}`, `{"a":1,"b":2}`, `{"a":{"x": [1, 2]},"b":2}`},
+		{"set nested path", `set meta.load true`, `{"meta":{"x":1}}`, `{"meta":{"x":1,"load":true}}`},
+		{"set env string", `set tenant "load-${PROPHER_TEST_USER}"`, `{}`, `{"tenant":"load-ann \"q\""}`},
+		{"set env nested", `set meta {"k": "${PROPHER_TEST_HOST}", "l": ["${PROPHER_TEST_HOST}-2", 3], "${PROPHER_TEST_HOST}": 1}`, `{}`,
+			`{"meta":{"k": "h1", "l": ["h1-2", 3], "${PROPHER_TEST_HOST}": 1}}`},
+		{"delete", `delete meta.secret`, `{"meta":{"secret":"s","x":1}}`, `{"meta":{"x":1}}`},
+		{"delete missing", `delete secret`, `{"a":1}`, `{"a":1}`},
+		{"delete duplicates", `delete pii`, `{"pii":"x","a":1,"pii":"y"}`, `{"a":1}`},
+		{"delete only duplicates", `delete pii`, `{"pii":"x","pii":"y"}`, `{}`},
+		{"rename", `rename user_id meta.user.id`, `{"user_id":7,"meta":{}}`, `{"meta":{"user":{"id":7}}}`},
+		{"rename keeps bytes", `rename n m`, `{"n":1.50e3}`, `{"m":1.50e3}`},
+		{"rename duplicates", `rename pii p`, `{"pii":"x","pii":"y"}`, `{"p":"y"}`},
+		{"rename missing", `rename a b`, `{"c":1}`, `{"c":1}`},
+		{"choice single", `choice region ["eu"]`, `{}`, `{"region":"eu"}`},
+		{"seq", `seq order_no 1000 10`, `{}`, `{"order_no":1000}`},
+		{"env", `env host PROPHER_TEST_HOST`, `{}`, `{"host":"h1"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMutator(t, 1, tt.rule)
+			got, err := m.apply([]byte(tt.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("%s on %s = %s, want %s", tt.rule, tt.doc, got, tt.want)
+			}
+		})
+	}
+}
+
+// applyCommit применяет правила к записанному сообщению.
+func applyCommit(t *testing.T, m *mutator, doc string) string {
+	t.Helper()
+	got, err := m.apply([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.commit()
+	return string(got)
+}
+
+func TestMutatorSeq(t *testing.T) {
+	m := newTestMutator(t, 1, "seq n 5", "seq d 10 -3")
+	for i, want := range []string{`{"n":5,"d":10}`, `{"n":6,"d":7}`, `{"n":7,"d":4}`} {
+		if got := applyCommit(t, m, `{}`); got != want {
+			t.Errorf("message %d = %s, want %s", i, got, want)
+		}
+	}
+	// Значение любого типа заменяется числом, счетчик идет дальше.
+	applyCommit(t, m, `{"n":{"x":1},"d":[1]}`)
+	if got := applyCommit(t, m, `{}`); got != `{"n":9,"d":-2}` {
+		t.Errorf("after replaced values: %s", got)
+	}
+}
+
+// TestMutatorUncommitted проверяет, что отброшенные строки не сдвигают seq и choice.
+func TestMutatorUncommitted(t *testing.T) {
+	rules := []string{"seq n 1", `choice r [1,2,3,4,5,6,7,8,9]`, "set meta.x 1"}
+	want := newTestMutator(t, 7, rules...)
+	m := newTestMutator(t, 7, rules...)
+	for i := 0; i < 20; i++ {
+		// Строка, на которой правило падает, и строка, отброшенная после правил.
+		if _, err := m.apply([]byte(`{"meta":"x"}`)); err == nil {
+			t.Fatal("set through a string: want error")
+		}
+		if _, err := m.apply([]byte(`{}`)); err != nil {
+			t.Fatal(err)
+		}
+		if got, w := applyCommit(t, m, `{}`), applyCommit(t, want, `{}`); got != w {
+			t.Fatalf("message %d = %s, want %s", i, got, w)
+		}
+	}
+}
+
+func TestMutatorReservedFields(t *testing.T) {
+	reserved := []string{"sent_epoch", "message_id", "orig_message_id", "", "meta.trace"}
+	write := func(rule string) string {
+		path := filepath.Join(t.TempDir(), "rules.txt")
+		if err := os.WriteFile(path, []byte(rule), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	for _, rule := range []string{
+		`set message_id "x"`,
+		"delete sent_epoch",
+		"delete /sent_epoch",
+		"rename orig_message_id o",
+		"rename tenant message_id",
+		"seq meta.trace 1",
+		"delete meta",
+		`set meta {"a":1}`,
+		"env meta.trace.id HOME",
+	} {
+		if _, err := loadMutator(write(rule), 1, reserved...); err == nil {
+			t.Errorf("%q: want reserved field error", rule)
+		}
+	}
+	for _, rule := range []string{`set meta.tenant "x"`, "delete sent", "rename message_ids m", "seq meta.trace_n 1"} {
+		if _, err := loadMutator(write(rule), 1, reserved...); err != nil {
+			t.Errorf("%q: %v", rule, err)
+		}
+	}
+}
+
+func TestMutatorChoiceSeed(t *testing.T) {
+	pick := func(m *mutator) string {
+		var out []string
+		for i := 0; i < 50; i++ {
+			v, _ := getJSONField([]byte(applyCommit(t, m, `{}`)), "region")
+			out = append(out, string(v))
+		}
+		return strings.Join(out, ",")
+	}
+	rule := `choice region ["eu","us","ap",{"x":1}]`
+	a := pick(newTestMutator(t, 42, rule))
+	if b := pick(newTestMutator(t, 42, rule)); a != b {
+		t.Errorf("same seed, different choices:\n%s\n%s", a, b)
+	}
+	if c := pick(newTestMutator(t, 43, rule)); a == c {
+		t.Errorf("seeds 42 and 43 gave the same choices")
+	}
+	for _, v := range []string{`"eu"`, `"us"`, `"ap"`, `{"x":1}`} {
+		if !strings.Contains(a, v) {
+			t.Errorf("choice %s never picked in %s", v, a)
+		}
+	}
+	if m := newTestMutator(t, 0, rule); m.seed == 0 {
+		t.Errorf("seed 0 must be replaced by a random seed")
+	}
+}
+
+func TestMutatorOrderAndErrors(t *testing.T) {
+	m := newTestMutator(t, 1, "# comment", "", "rename a b", "set b.c 1", "delete a")
+	got, err := m.apply([]byte(`{"a":{"x":0}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `{"b":{"x":0,"c":1}}` {
+		t.Errorf("rules in order = %s", got)
+	}
+	if _, err := newTestMutator(t, 1, "set meta.ts 1").apply([]byte(`{"meta":"x"}`)); err == nil {
+		t.Errorf("set through a string: want error")
+	}
+}
+
+func TestParseMutationErrors(t *testing.T) {
+	t.Setenv("PROPHER_TEST_UNSET", "")
+	os.Unsetenv("PROPHER_TEST_UNSET")
+	for _, line := range []string{
+		"set",
+		"set a",
+		"set a {bad",
+		`set a "${PROPHER_TEST_UNSET}"`,
+		`set a {"k":["${PROPHER_TEST_UNSET}"]}`,
+		"delete a extra",
+		"delete items[0]",
+		"rename a",
+		"rename a a",
+		"rename a b..c",
+		"choice a []",
+		`choice a "x"`,
+		"seq a x",
+		"seq a 1 y",
+		"env a PROPHER_TEST_UNSET",
+		"env a",
+		"drop a",
+		"set a..b 1",
+	} {
+		if _, err := parseMutation(line); err == nil {
+			t.Errorf("%q: want error", line)
+		}
+	}
+}
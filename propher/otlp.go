@@ -0,0 +1,311 @@
+package propher
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// otlpBatchSize - спанов в одном запросе к коллектору.
+	otlpBatchSize = 512
+	// otlpQueueSize - буфер спанов; при переполнении спаны отбрасываются, чтобы не тормозить чтение.
+	otlpQueueSize  = 16 * 1024
+	otlpFlushEvery = time.Second
+	otlpTimeout    = 10 * time.Second
+	// otlpSpanKindConsumer - SPAN_KIND_CONSUMER.
+	otlpSpanKindConsumer = 5
+)
+
+// Структуры OTLP/HTTP в JSON-кодировке (ExportTraceServiceRequest).
+type otlpExportRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue,omitempty"`
+	// IntValue - int64 в JSON-кодировке OTLP передается строкой.
+	IntValue string `json:"intValue,omitempty"`
+}
+
+func otlpString(key, v string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: v}}
+}
+
+func otlpInt(key string, v int64) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{IntValue: strconv.FormatInt(v, 10)}}
+}
+
+// otlpTracesURL дополняет базовый адрес коллектора путем /v1/traces.
+func otlpTracesURL(endpoint string) string {
+	endpoint = strings.TrimRight(strings.TrimSpace(endpoint), "/")
+	if strings.HasSuffix(endpoint, "/v1/traces") {
+		return endpoint
+	}
+	return endpoint + "/v1/traces"
+}
+
+// parseOTLPHeaders разбирает заголовки в формате OTEL_EXPORTER_OTLP_HEADERS: "k=v,k2=v2".
+func parseOTLPHeaders(s string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(part, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("bad otlp header %q (want key=value)", part)
+		}
+		if dv, err := url.QueryUnescape(strings.TrimSpace(v)); err == nil {
+			v = dv
+		}
+		out[strings.TrimSpace(k)] = v
+	}
+	return out, nil
+}
+
+// otlpTraceIDs выбирает trace id спана: из traceparent или hex trace id записи,
+// иначе детерминированно из trace id или message_id.
+func otlpTraceIDs(rec Record) (traceID, parentID string) {
+	if t, p, ok := parseTraceparent(rec.TraceID); ok {
+		return t, p
+	}
+	if isHexID(rec.TraceID, 32) {
+		return strings.ToLower(rec.TraceID), ""
+	}
+	key := rec.TraceID
+	if key == "" {
+		key = rec.MessageID
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16]), ""
+}
+
+func otlpSpanID() string {
+	for {
+		if id := rand.Uint64(); id != 0 {
+			return fmt.Sprintf("%016x", id)
+		}
+	}
+}
+
+// otlpSpanFromRecord строит спан от отправки в источнике до чтения из очереди.
+func otlpSpanFromRecord(rec Record) otlpSpan {
+	traceID, parentID := otlpTraceIDs(rec)
+	readUs := *rec.ResultSentUs + *rec.LatencyUs
+	span := otlpSpan{
+		TraceID:           traceID,
+		SpanID:            otlpSpanID(),
+		ParentSpanID:      parentID,
+		Name:              "propher.measure",
+		Kind:              otlpSpanKindConsumer,
+		StartTimeUnixNano: strconv.FormatInt(*rec.SourceSentUs*1000, 10),
+		EndTimeUnixNano:   strconv.FormatInt(readUs*1000, 10),
+		Attributes: []otlpKeyValue{
+			otlpString("messaging.message.id", rec.MessageID),
+			otlpInt("propher.serve_us", *rec.ServeUs),
+			otlpInt("propher.latency_us", *rec.LatencyUs),
+		},
+	}
+	if rec.ResultMessageID != "" {
+		span.Attributes = append(span.Attributes, otlpString("propher.result_message_id", rec.ResultMessageID))
+	}
+	if rec.Excluded != "" {
+		span.Attributes = append(span.Attributes, otlpString("propher.excluded", rec.Excluded))
+	}
+	hops := make([]string, 0, len(rec.HopsUs))
+	for name := range rec.HopsUs {
+		hops = append(hops, name)
+	}
+	sort.Strings(hops)
+	for _, name := range hops {
+		span.Attributes = append(span.Attributes, otlpInt("propher.hop."+name+"_us", rec.HopsUs[name]))
+	}
+	return span
+}
+
+// otlpExporter отправляет успешные записи спанами в OTLP-коллектор.
+// Ошибки отправки не прерывают измерение: итог печатается при закрытии.
+type otlpExporter struct {
+	url      string
+	headers  map[string]string
+	resource []otlpKeyValue
+	spans    chan otlpSpan
+	done     chan struct{}
+	closed   bool
+
+	dropped int
+	sent    int
+	failed  int
+	lastErr error
+}
+
+// newOTLPExporter запускает фоновую отправку; resource - атрибуты ресурса кроме service.name.
+func newOTLPExporter(endpoint, headers, service string, resource map[string]string) (*otlpExporter, error) {
+	h, err := parseOTLPHeaders(headers)
+	if err != nil {
+		return nil, err
+	}
+	e := &otlpExporter{
+		url:      otlpTracesURL(endpoint),
+		headers:  h,
+		resource: []otlpKeyValue{otlpString("service.name", service)},
+		spans:    make(chan otlpSpan, otlpQueueSize),
+		done:     make(chan struct{}),
+	}
+	keys := make([]string, 0, len(resource))
+	for k := range resource {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if resource[k] != "" {
+			e.resource = append(e.resource, otlpString(k, resource[k]))
+		}
+	}
+	go e.run()
+	return e, nil
+}
+
+func (e *otlpExporter) run() {
+	defer close(e.done)
+	t := time.NewTicker(otlpFlushEvery)
+	defer t.Stop()
+	batch := make([]otlpSpan, 0, otlpBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil {
+			if e.lastErr == nil {
+				measureLogger.Printf("[WARN] otlp export failed: %v", err)
+			}
+			e.failed += len(batch)
+			e.lastErr = err
+		} else {
+			e.sent += len(batch)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case span, ok := <-e.spans:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) >= otlpBatchSize {
+				flush()
+			}
+		case <-t.C:
+			flush()
+		}
+	}
+}
+
+func (e *otlpExporter) send(batch []otlpSpan) error {
+	body, err := json.Marshal(otlpExportRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: e.resource},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "propher"}, Spans: batch}},
+	}}})
+	if err != nil {
+		return fmt.Errorf("marshal otlp spans: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), otlpTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("otlp request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("otlp: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("otlp: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// Write ставит спан успешной записи в очередь отправки; остальные записи пропускаются.
+func (e *otlpExporter) Write(rec Record) error {
+	if !rec.OK {
+		return nil
+	}
+	select {
+	case e.spans <- otlpSpanFromRecord(rec):
+	default:
+		e.dropped++
+	}
+	return nil
+}
+
+// Close дожидается отправки оставшихся спанов; повторный вызов безопасен.
+func (e *otlpExporter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	close(e.spans)
+	<-e.done
+	measureLogger.Printf("[OTLP] url=%s sent=%d failed=%d dropped=%d", e.url, e.sent, e.failed, e.dropped)
+	if e.failed > 0 {
+		measureLogger.Printf("[WARN] otlp: %d spans not exported, last error: %v", e.failed, e.lastErr)
+	}
+	return nil
+}
+
+func (e *otlpExporter) Path() string { return e.url }
@@ -0,0 +1,388 @@
+package propher
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// Минимальный писатель Parquet без внешних зависимостей: плоская схема,
+// PLAIN-кодирование, без сжатия, по одной data page на колонку в row group.
+
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	parquetConvertedUTF8 = 0
+
+	parquetEncodingPlain = 0
+	parquetEncodingRLE   = 3
+
+	// parquetRowGroupRows - сколько строк держать в памяти до сброса row group.
+	parquetRowGroupRows = 64 * 1024
+)
+
+// parquetColumnSpec описывает колонку плоской схемы.
+type parquetColumnSpec struct {
+	Name     string
+	Type     int32
+	Optional bool
+}
+
+// parquetValue - значение ячейки; Null для пустых optional-колонок.
+type parquetValue struct {
+	Null  bool
+	Bool  bool
+	Int64 int64
+	Bytes string
+}
+
+// parquetColumn копит значения колонки текущей row group.
+type parquetColumn struct {
+	spec    parquetColumnSpec
+	defs    []bool
+	bools   []bool
+	data    []byte
+	numRows int
+}
+
+func (c *parquetColumn) add(v parquetValue) error {
+	c.numRows++
+	if c.spec.Optional {
+		c.defs = append(c.defs, !v.Null)
+		if v.Null {
+			return nil
+		}
+	} else if v.Null {
+		return fmt.Errorf("parquet: null in required column %s", c.spec.Name)
+	}
+	switch c.spec.Type {
+	case parquetBoolean:
+		c.bools = append(c.bools, v.Bool)
+	case parquetInt64:
+		c.data = binary.LittleEndian.AppendUint64(c.data, uint64(v.Int64))
+	case parquetByteArray:
+		c.data = binary.LittleEndian.AppendUint32(c.data, uint32(len(v.Bytes)))
+		c.data = append(c.data, v.Bytes...)
+	}
+	return nil
+}
+
+// page собирает тело data page v1: уровни определения и значения.
+func (c *parquetColumn) page() []byte {
+	var out []byte
+	if c.spec.Optional {
+		levels := encodeBitPackedLevels(c.defs)
+		out = binary.LittleEndian.AppendUint32(out, uint32(len(levels)))
+		out = append(out, levels...)
+	}
+	if c.spec.Type == parquetBoolean {
+		return append(out, packBits(c.bools)...)
+	}
+	return append(out, c.data...)
+}
+
+func (c *parquetColumn) reset() {
+	c.defs = c.defs[:0]
+	c.bools = c.bools[:0]
+	c.data = c.data[:0]
+	c.numRows = 0
+}
+
+// encodeBitPackedLevels кодирует уровни 0/1 одним bit-packed прогоном RLE/bit-packing hybrid.
+func encodeBitPackedLevels(levels []bool) []byte {
+	groups := (len(levels) + 7) / 8
+	out := binary.AppendUvarint(nil, uint64(groups)<<1|1)
+	return append(out, packBits(levels)...)
+}
+
+// packBits упаковывает значения по биту, младший бит первым.
+func packBits(vals []bool) []byte {
+	out := make([]byte, (len(vals)+7)/8)
+	for i, v := range vals {
+		if v {
+			out[i/8] |= 1 << (i % 8)
+		}
+	}
+	return out
+}
+
+// parquetChunkMeta - метаданные записанного column chunk.
+type parquetChunkMeta struct {
+	offset    int64
+	size      int64
+	numValues int64
+}
+
+type parquetRowGroupMeta struct {
+	chunks  []parquetChunkMeta
+	numRows int64
+	size    int64
+}
+
+// parquetWriter пишет плоскую таблицу в файл Parquet.
+type parquetWriter struct {
+	f         *os.File
+	w         *bufio.Writer
+	offset    int64
+	columns   []*parquetColumn
+	rowGroups []parquetRowGroupMeta
+	numRows   int64
+	closed    bool
+}
+
+func createParquetFile(path string, specs []parquetColumnSpec) (*parquetWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create parquet file: %w", err)
+	}
+	pw := &parquetWriter{f: f, w: bufio.NewWriterSize(f, 1<<20)}
+	for _, spec := range specs {
+		pw.columns = append(pw.columns, &parquetColumn{spec: spec})
+	}
+	if err := pw.write([]byte("PAR1")); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return pw, nil
+}
+
+func (pw *parquetWriter) write(b []byte) error {
+	n, err := pw.w.Write(b)
+	pw.offset += int64(n)
+	if err != nil {
+		return fmt.Errorf("write parquet file: %w", err)
+	}
+	return nil
+}
+
+// WriteRow добавляет строку; значения идут в порядке колонок схемы.
+func (pw *parquetWriter) WriteRow(row []parquetValue) error {
+	if len(row) != len(pw.columns) {
+		return fmt.Errorf("parquet: row has %d values, schema has %d columns", len(row), len(pw.columns))
+	}
+	for i, v := range row {
+		if err := pw.columns[i].add(v); err != nil {
+			return err
+		}
+	}
+	if pw.columns[0].numRows >= parquetRowGroupRows {
+		return pw.flushRowGroup()
+	}
+	return nil
+}
+
+// flushRowGroup пишет накопленные колонки как одну row group.
+func (pw *parquetWriter) flushRowGroup() error {
+	numRows := pw.columns[0].numRows
+	if numRows == 0 {
+		return nil
+	}
+	rg := parquetRowGroupMeta{numRows: int64(numRows)}
+	for _, col := range pw.columns {
+		body := col.page()
+
+		var h thriftWriter
+		h.i32(1, 0) // DATA_PAGE
+		h.i32(2, int32(len(body)))
+		h.i32(3, int32(len(body)))
+		h.structBegin(5)
+		h.i32(1, int32(numRows))
+		h.i32(2, parquetEncodingPlain)
+		h.i32(3, parquetEncodingRLE)
+		h.i32(4, parquetEncodingRLE)
+		h.structEnd()
+		h.stop()
+
+		chunk := parquetChunkMeta{offset: pw.offset, numValues: int64(numRows)}
+		if err := pw.write(h.buf); err != nil {
+			return err
+		}
+		if err := pw.write(body); err != nil {
+			return err
+		}
+		chunk.size = pw.offset - chunk.offset
+		rg.size += chunk.size
+		rg.chunks = append(rg.chunks, chunk)
+		col.reset()
+	}
+	pw.rowGroups = append(pw.rowGroups, rg)
+	pw.numRows += int64(numRows)
+	return nil
+}
+
+// Close дописывает последнюю row group и футер; повторный вызов безопасен.
+func (pw *parquetWriter) Close() error {
+	if pw.closed {
+		return nil
+	}
+	pw.closed = true
+	if err := pw.flushRowGroup(); err != nil {
+		pw.f.Close()
+		return err
+	}
+
+	var m thriftWriter
+	m.i32(1, 1)
+	m.listBegin(2, thriftStruct, len(pw.columns)+1)
+	m.elemBegin()
+	m.binary(4, "schema")
+	m.i32(5, int32(len(pw.columns)))
+	m.elemEnd()
+	for _, col := range pw.columns {
+		m.elemBegin()
+		m.i32(1, col.spec.Type)
+		rep := int32(parquetRequired)
+		if col.spec.Optional {
+			rep = parquetOptional
+		}
+		m.i32(3, rep)
+		m.binary(4, col.spec.Name)
+		if col.spec.Type == parquetByteArray {
+			m.i32(6, parquetConvertedUTF8)
+		}
+		m.elemEnd()
+	}
+	m.i64(3, pw.numRows)
+	m.listBegin(4, thriftStruct, len(pw.rowGroups))
+	for _, rg := range pw.rowGroups {
+		m.elemBegin()
+		m.listBegin(1, thriftStruct, len(rg.chunks))
+		for i, chunk := range rg.chunks {
+			col := pw.columns[i]
+			m.elemBegin()
+			m.i64(2, chunk.offset)
+			m.structBegin(3)
+			m.i32(1, col.spec.Type)
+			m.i32List(2, []int32{parquetEncodingPlain, parquetEncodingRLE})
+			m.binaryList(3, []string{col.spec.Name})
+			m.i32(4, 0) // UNCOMPRESSED
+			m.i64(5, chunk.numValues)
+			m.i64(6, chunk.size)
+			m.i64(7, chunk.size)
+			m.i64(9, chunk.offset)
+			m.structEnd()
+			m.elemEnd()
+		}
+		m.i64(2, rg.size)
+		m.i64(3, rg.numRows)
+		m.elemEnd()
+	}
+	m.binary(6, "propher")
+	m.stop()
+
+	if err := pw.write(m.buf); err != nil {
+		pw.f.Close()
+		return err
+	}
+	tail := binary.LittleEndian.AppendUint32(nil, uint32(len(m.buf)))
+	if err := pw.write(append(tail, "PAR1"...)); err != nil {
+		pw.f.Close()
+		return err
+	}
+	if err := pw.w.Flush(); err != nil {
+		pw.f.Close()
+		return fmt.Errorf("flush parquet file: %w", err)
+	}
+	return pw.f.Close()
+}
+
+// Типы полей Thrift compact protocol.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter кодирует метаданные Parquet в Thrift compact protocol.
+type thriftWriter struct {
+	buf  []byte
+	last []int16
+	cur  int16
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	if delta := id - t.cur; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.buf = binary.AppendVarint(t.buf, int64(id))
+	}
+	t.cur = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.buf = binary.AppendVarint(t.buf, int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.buf = binary.AppendVarint(t.buf, v)
+}
+
+func (t *thriftWriter) binary(id int16, v string) {
+	t.field(id, thriftBinary)
+	t.buf = binary.AppendUvarint(t.buf, uint64(len(v)))
+	t.buf = append(t.buf, v...)
+}
+
+func (t *thriftWriter) listHeader(elemType byte, n int) {
+	if n < 15 {
+		t.buf = append(t.buf, byte(n)<<4|elemType)
+		return
+	}
+	t.buf = append(t.buf, 0xF0|elemType)
+	t.buf = binary.AppendUvarint(t.buf, uint64(n))
+}
+
+func (t *thriftWriter) listBegin(id int16, elemType byte, n int) {
+	t.field(id, thriftList)
+	t.listHeader(elemType, n)
+}
+
+func (t *thriftWriter) i32List(id int16, vals []int32) {
+	t.listBegin(id, thriftI32, len(vals))
+	for _, v := range vals {
+		t.buf = binary.AppendVarint(t.buf, int64(v))
+	}
+}
+
+func (t *thriftWriter) binaryList(id int16, vals []string) {
+	t.listBegin(id, thriftBinary, len(vals))
+	for _, v := range vals {
+		t.buf = binary.AppendUvarint(t.buf, uint64(len(v)))
+		t.buf = append(t.buf, v...)
+	}
+}
+
+// structBegin открывает вложенную структуру-поле.
+func (t *thriftWriter) structBegin(id int16) {
+	t.field(id, thriftStruct)
+	t.elemBegin()
+}
+
+func (t *thriftWriter) structEnd() { t.elemEnd() }
+
+// elemBegin открывает структуру-элемент списка.
+func (t *thriftWriter) elemBegin() {
+	t.last = append(t.last, t.cur)
+	t.cur = 0
+}
+
+func (t *thriftWriter) elemEnd() {
+	t.stop()
+	t.cur = t.last[len(t.last)-1]
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thriftWriter) stop() {
+	t.buf = append(t.buf, 0)
+}
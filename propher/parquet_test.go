@@ -0,0 +1,365 @@
+package propher
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// thriftReader - минимальный декодер Thrift compact protocol для проверки футера.
+// Структура читается в map[id]значение: целые - int64, binary - []byte, list - []any.
+type thriftReader struct {
+	t   *testing.T
+	buf []byte
+}
+
+func (r *thriftReader) byte() byte {
+	if len(r.buf) == 0 {
+		r.t.Fatalf("thrift: unexpected end of data")
+	}
+	b := r.buf[0]
+	r.buf = r.buf[1:]
+	return b
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.t.Fatalf("thrift: bad varint")
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *thriftReader) varint() int64 {
+	v, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.t.Fatalf("thrift: bad zigzag varint")
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case 1:
+		return true
+	case 2:
+		return false
+	case 3:
+		return int64(int8(r.byte()))
+	case 4, thriftI32, thriftI64:
+		return r.varint()
+	case thriftBinary:
+		n := r.uvarint()
+		v := r.buf[:n]
+		r.buf = r.buf[n:]
+		return v
+	case thriftList:
+		h := r.byte()
+		n := int(h >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]any, n)
+		for i := range list {
+			list[i] = r.value(h & 0x0f)
+		}
+		return list
+	case thriftStruct:
+		return r.structValue()
+	}
+	r.t.Fatalf("thrift: unsupported type %d", typ)
+	return nil
+}
+
+func (r *thriftReader) structValue() map[int16]any {
+	out := map[int16]any{}
+	var last int16
+	for {
+		h := r.byte()
+		if h == 0 {
+			return out
+		}
+		id := last + int16(h>>4)
+		if h>>4 == 0 {
+			id = int16(r.varint())
+		}
+		last = id
+		out[id] = r.value(h & 0x0f)
+	}
+}
+
+func thriftIntField(t *testing.T, s map[int16]any, id int16) int64 {
+	t.Helper()
+	v, ok := s[id].(int64)
+	if !ok {
+		t.Fatalf("thrift field %d: want integer, got %T", id, s[id])
+	}
+	return v
+}
+
+func thriftStringField(t *testing.T, s map[int16]any, id int16) string {
+	t.Helper()
+	v, ok := s[id].([]byte)
+	if !ok {
+		t.Fatalf("thrift field %d: want binary, got %T", id, s[id])
+	}
+	return string(v)
+}
+
+func thriftListField(t *testing.T, s map[int16]any, id int16) []any {
+	t.Helper()
+	v, ok := s[id].([]any)
+	if !ok {
+		t.Fatalf("thrift field %d: want list, got %T", id, s[id])
+	}
+	return v
+}
+
+// decodeParquetLevels разбирает уровни определения RLE/bit-packing hybrid (ширина 1 бит).
+func decodeParquetLevels(t *testing.T, b []byte, n int) []bool {
+	t.Helper()
+	r := &thriftReader{t: t, buf: b}
+	var out []bool
+	for len(out) < n {
+		h := r.uvarint()
+		if h&1 == 0 {
+			count := int(h >> 1)
+			v := r.byte() != 0
+			for i := 0; i < count; i++ {
+				out = append(out, v)
+			}
+			continue
+		}
+		// При ширине 1 бит группа из 8 значений занимает байт.
+		groups := int(h >> 1)
+		for i := 0; i < groups*8; i++ {
+			out = append(out, r.buf[i/8]>>(i%8)&1 == 1)
+		}
+		r.buf = r.buf[groups:]
+	}
+	return out[:n]
+}
+
+// readParquetColumn читает все data pages колонки и возвращает значения по строкам (nil - null).
+func readParquetColumn(t *testing.T, file []byte, spec parquetColumnSpec, chunk map[int16]any) []any {
+	t.Helper()
+	meta := chunk[3].(map[int16]any)
+	offset := thriftIntField(t, meta, 9)
+	if fileOffset := thriftIntField(t, chunk, 2); fileOffset != offset {
+		t.Errorf("%s: file_offset %d != data_page_offset %d", spec.Name, fileOffset, offset)
+	}
+	size := thriftIntField(t, meta, 7)
+	r := &thriftReader{t: t, buf: file[offset : offset+size]}
+	header := r.structValue()
+	if typ := thriftIntField(t, header, 1); typ != 0 {
+		t.Fatalf("%s: page type %d, want DATA_PAGE", spec.Name, typ)
+	}
+	bodyLen := thriftIntField(t, header, 3)
+	if thriftIntField(t, header, 2) != bodyLen || int64(len(r.buf)) != bodyLen {
+		t.Fatalf("%s: page body %d bytes, header says %d", spec.Name, len(r.buf), bodyLen)
+	}
+	dataHeader := header[5].(map[int16]any)
+	numValues := int(thriftIntField(t, dataHeader, 1))
+	if enc := thriftIntField(t, dataHeader, 2); enc != parquetEncodingPlain {
+		t.Errorf("%s: encoding %d, want PLAIN", spec.Name, enc)
+	}
+
+	body := r.buf
+	defs := make([]bool, numValues)
+	for i := range defs {
+		defs[i] = true
+	}
+	if spec.Optional {
+		n := binary.LittleEndian.Uint32(body)
+		defs = decodeParquetLevels(t, body[4:4+n], numValues)
+		body = body[4+n:]
+	}
+	out := make([]any, numValues)
+	bit := 0
+	for i, defined := range defs {
+		if !defined {
+			continue
+		}
+		switch spec.Type {
+		case parquetBoolean:
+			out[i] = body[bit/8]>>(bit%8)&1 == 1
+			bit++
+		case parquetInt64:
+			out[i] = int64(binary.LittleEndian.Uint64(body))
+			body = body[8:]
+		case parquetByteArray:
+			n := binary.LittleEndian.Uint32(body)
+			out[i] = string(body[4 : 4+n])
+			body = body[4+n:]
+		}
+	}
+	if spec.Type == parquetBoolean {
+		body = body[(bit+7)/8:]
+	}
+	if len(body) != 0 {
+		t.Errorf("%s: %d trailing bytes in page", spec.Name, len(body))
+	}
+	return out
+}
+
+func testParquetRow(i int) []parquetValue {
+	row := []parquetValue{
+		{Bool: i%3 != 0},
+		{Bytes: "m" + strconv.Itoa(i)},
+		{Int64: int64(i) * 1_000_003},
+		{Bytes: "tenant-" + strconv.Itoa(i%5)},
+	}
+	if i%4 == 0 {
+		row[1] = parquetValue{Null: true}
+	}
+	if i%7 == 0 {
+		row[2] = parquetValue{Null: true}
+	}
+	return row
+}
+
+func TestParquetWriterRoundTrip(t *testing.T) {
+	specs := []parquetColumnSpec{
+		{Name: "ok", Type: parquetBoolean},
+		{Name: "message_id", Type: parquetByteArray, Optional: true},
+		{Name: "serve_us", Type: parquetInt64, Optional: true},
+		{Name: "tenant", Type: parquetByteArray},
+	}
+	// Больше одной row group и неполный последний байт битовых колонок.
+	rows := parquetRowGroupRows + 13
+
+	path := filepath.Join(t.TempDir(), "records.parquet")
+	pw, err := createParquetFile(path, specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < rows; i++ {
+		if err := pw.WriteRow(testParquetRow(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pw.WriteRow([]parquetValue{{}}); err == nil {
+		t.Errorf("short row: want error")
+	}
+	if err := pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := pw.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+
+	file, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(file, []byte("PAR1")) || !bytes.HasSuffix(file, []byte("PAR1")) {
+		t.Fatalf("missing PAR1 magic")
+	}
+	footerLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	footer := &thriftReader{t: t, buf: file[len(file)-8-footerLen : len(file)-8]}
+	meta := footer.structValue()
+	if len(footer.buf) != 0 {
+		t.Errorf("%d bytes left after FileMetaData", len(footer.buf))
+	}
+
+	if v := thriftIntField(t, meta, 1); v != 1 {
+		t.Errorf("version = %d", v)
+	}
+	if v := thriftIntField(t, meta, 3); v != int64(rows) {
+		t.Errorf("num_rows = %d, want %d", v, rows)
+	}
+	if v := thriftStringField(t, meta, 6); v != "propher" {
+		t.Errorf("created_by = %q", v)
+	}
+	schema := thriftListField(t, meta, 2)
+	if len(schema) != len(specs)+1 {
+		t.Fatalf("schema elements = %d, want %d", len(schema), len(specs)+1)
+	}
+	root := schema[0].(map[int16]any)
+	if thriftStringField(t, root, 4) != "schema" || thriftIntField(t, root, 5) != int64(len(specs)) {
+		t.Errorf("root schema element = %v", root)
+	}
+	for i, spec := range specs {
+		el := schema[i+1].(map[int16]any)
+		rep := int64(parquetRequired)
+		if spec.Optional {
+			rep = parquetOptional
+		}
+		if thriftStringField(t, el, 4) != spec.Name || thriftIntField(t, el, 1) != int64(spec.Type) || thriftIntField(t, el, 3) != rep {
+			t.Errorf("schema element %d = %v, want %+v", i, el, spec)
+		}
+		if _, utf8 := el[6]; utf8 != (spec.Type == parquetByteArray) {
+			t.Errorf("%s: UTF8 converted type present = %v", spec.Name, utf8)
+		}
+	}
+
+	groups := thriftListField(t, meta, 4)
+	if len(groups) != 2 {
+		t.Fatalf("row groups = %d, want 2", len(groups))
+	}
+	got := make([][]any, len(specs))
+	var totalRows int64
+	for _, g := range groups {
+		rg := g.(map[int16]any)
+		rgRows := thriftIntField(t, rg, 3)
+		totalRows += rgRows
+		chunks := thriftListField(t, rg, 1)
+		if len(chunks) != len(specs) {
+			t.Fatalf("column chunks = %d, want %d", len(chunks), len(specs))
+		}
+		var size int64
+		for c, ch := range chunks {
+			chunk := ch.(map[int16]any)
+			cm := chunk[3].(map[int16]any)
+			if path := thriftListField(t, cm, 3); len(path) != 1 || string(path[0].([]byte)) != specs[c].Name {
+				t.Errorf("path_in_schema = %v", path)
+			}
+			if thriftIntField(t, cm, 5) != rgRows {
+				t.Errorf("%s: num_values = %d, want %d", specs[c].Name, thriftIntField(t, cm, 5), rgRows)
+			}
+			size += thriftIntField(t, cm, 7)
+			got[c] = append(got[c], readParquetColumn(t, file, specs[c], chunk)...)
+		}
+		if thriftIntField(t, rg, 2) != size {
+			t.Errorf("row group total_byte_size = %d, want %d", thriftIntField(t, rg, 2), size)
+		}
+	}
+	if totalRows != int64(rows) {
+		t.Errorf("row group rows = %d, want %d", totalRows, rows)
+	}
+
+	for i := 0; i < rows; i++ {
+		for c, want := range testParquetRow(i) {
+			var w any
+			if !want.Null {
+				switch specs[c].Type {
+				case parquetBoolean:
+					w = want.Bool
+				case parquetInt64:
+					w = want.Int64
+				case parquetByteArray:
+					w = want.Bytes
+				}
+			}
+			if got[c][i] != w {
+				t.Fatalf("row %d column %s = %v, want %v", i, specs[c].Name, got[c][i], w)
+			}
+		}
+	}
+}
+
+func TestParquetRequiredNull(t *testing.T) {
+	pw, err := createParquetFile(filepath.Join(t.TempDir(), "x.parquet"), []parquetColumnSpec{{Name: "ok", Type: parquetBoolean}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pw.Close()
+	if err := pw.WriteRow([]parquetValue{{Null: true}}); err == nil {
+		t.Errorf("null in required column: want error")
+	}
+}
@@ -0,0 +1,270 @@
+package propher
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"propher/internal/config"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pushSample - одна итоговая метрика прогона.
+type pushSample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// statsSamples раскладывает stats-файл в набор gauge-метрик.
+func statsSamples(stats measureStatsFile) []pushSample {
+	out := []pushSample{
+		{Name: "propher_run_total_read", Value: float64(stats.TotalRead)},
+		{Name: "propher_run_ok", Value: float64(stats.OK)},
+		{Name: "propher_run_bad", Value: float64(stats.Bad)},
+		{Name: "propher_run_duration_seconds", Value: stats.DurationSec},
+		{Name: "propher_run_ok_throughput_msg_s", Value: stats.OKThroughputMsgS},
+		{Name: "propher_run_ok_throughput_bytes_s", Value: stats.OKThroughputBytesS},
+	}
+	if stats.MessagesInDump > 0 {
+		out = append(out,
+			pushSample{Name: "propher_run_messages_in_dump", Value: float64(stats.MessagesInDump)},
+			pushSample{Name: "propher_run_lost", Value: float64(stats.Lost)},
+			pushSample{Name: "propher_run_lost_ratio", Value: stats.LostRatio},
+		)
+	}
+	for _, dist := range []struct {
+		name string
+		d    *distributionStats
+	}{
+		{"serve_us", stats.ServeUs},
+		{"latency_us", stats.LatencyUs},
+		{"process_us", stats.ProcessUs},
+	} {
+		if dist.d == nil {
+			continue
+		}
+		name := "propher_run_" + dist.name
+		for _, label := range sortedPercentileLabels(dist.d.Percentiles) {
+			q := strings.TrimPrefix(label, "p")
+			if f, err := strconv.ParseFloat(q, 64); err == nil {
+				q = strconv.FormatFloat(math.Round(f*1e4)/1e6, 'f', -1, 64)
+			}
+			out = append(out, pushSample{
+				Name:   name,
+				Labels: map[string]string{"quantile": q},
+				Value:  float64(dist.d.Percentiles[label]),
+			})
+		}
+		out = append(out,
+			pushSample{Name: name + "_mean", Value: dist.d.Mean},
+			pushSample{Name: name + "_max", Value: float64(dist.d.Max)},
+			pushSample{Name: name + "_count", Value: float64(dist.d.Count)},
+		)
+	}
+	return out
+}
+
+// pushLabels - метки прогона; пустые значения не отправляются.
+func pushLabels(pushCfg config.PushConfig, stats measureStatsFile) map[string]string {
+	runID := pushCfg.RunID
+	if runID == "" {
+		runID = stats.Run["started_at"]
+	}
+	labels := map[string]string{}
+	for k, v := range map[string]string{
+		"run_id":     runID,
+		"git_commit": pushCfg.GitCommit,
+		"scenario":   pushCfg.Scenario,
+	} {
+		if v != "" {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// pushStats отправляет итоговую статистику в Pushgateway или remote-write.
+func pushStats(ctx context.Context, pushCfg config.PushConfig, stats measureStatsFile) error {
+	if pushCfg.URL == "" {
+		return nil
+	}
+	labels := pushLabels(pushCfg, stats)
+	samples := statsSamples(stats)
+
+	var req *http.Request
+	var err error
+	switch pushCfg.Format {
+	case "pushgateway":
+		target := pushgatewayURL(pushCfg.URL, pushCfg.Job, labels)
+		req, err = http.NewRequestWithContext(ctx, http.MethodPut, target, bytes.NewReader(encodePushText(samples)))
+		if err != nil {
+			return fmt.Errorf("push request: %w", err)
+		}
+		req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	case "remote-write":
+		// Метки прогона уходят в каждую серию вместе с job.
+		all := map[string]string{"job": pushCfg.Job}
+		for k, v := range labels {
+			all[k] = v
+		}
+		body := snappyEncodeLiteral(encodeWriteRequest(samples, all, time.Now().UnixMilli()))
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, pushCfg.URL, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("push request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		req.Header.Set("Content-Encoding", "snappy")
+		req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	default:
+		return fmt.Errorf("push-format must be pushgateway or remote-write")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("push: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("push: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	measureLogger.Printf("[PUSH] format=%s url=%s samples=%d status=%d", pushCfg.Format, req.URL, len(samples), resp.StatusCode)
+	return nil
+}
+
+// pushgatewayURL строит путь группировки /metrics/job/<job>/<label>/<value>...
+func pushgatewayURL(base, job string, labels map[string]string) string {
+	var b strings.Builder
+	b.WriteString(strings.TrimRight(base, "/"))
+	b.WriteString("/metrics")
+	b.WriteString(pushgatewayPathPair("job", job))
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString(pushgatewayPathPair(k, labels[k]))
+	}
+	return b.String()
+}
+
+// pushgatewayPathPair кодирует значения со слешем в base64, как требует Pushgateway.
+func pushgatewayPathPair(name, value string) string {
+	if value == "" || strings.Contains(value, "/") {
+		return "/" + name + "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+	return "/" + name + "/" + url.PathEscape(value)
+}
+
+// encodePushText выводит метрики в текстовом формате Prometheus.
+func encodePushText(samples []pushSample) []byte {
+	var b bytes.Buffer
+	typed := map[string]bool{}
+	for _, s := range samples {
+		if !typed[s.Name] {
+			fmt.Fprintf(&b, "# TYPE %s gauge\n", s.Name)
+			typed[s.Name] = true
+		}
+		b.WriteString(s.Name)
+		if len(s.Labels) > 0 {
+			keys := make([]string, 0, len(s.Labels))
+			for k := range s.Labels {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			b.WriteByte('{')
+			for i, k := range keys {
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				fmt.Fprintf(&b, "%s=%q", k, s.Labels[k])
+			}
+			b.WriteByte('}')
+		}
+		fmt.Fprintf(&b, " %s\n", strconv.FormatFloat(s.Value, 'g', -1, 64))
+	}
+	return b.Bytes()
+}
+
+// encodeWriteRequest кодирует prometheus.WriteRequest (protobuf) без внешних зависимостей.
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(samples []pushSample, common map[string]string, tsMs int64) []byte {
+	var out []byte
+	for _, s := range samples {
+		labels := map[string]string{"__name__": s.Name}
+		for k, v := range common {
+			labels[k] = v
+		}
+		for k, v := range s.Labels {
+			labels[k] = v
+		}
+		// Remote-write требует сортировки меток по имени.
+		names := make([]string, 0, len(labels))
+		for k := range labels {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		var series []byte
+		for _, name := range names {
+			var label []byte
+			label = protoBytes(label, 1, []byte(name))
+			label = protoBytes(label, 2, []byte(labels[name]))
+			series = protoBytes(series, 1, label)
+		}
+		var sample []byte
+		sample = protoTag(sample, 1, 1)
+		sample = binary.LittleEndian.AppendUint64(sample, math.Float64bits(s.Value))
+		sample = protoTag(sample, 2, 0)
+		sample = binary.AppendUvarint(sample, uint64(tsMs))
+		series = protoBytes(series, 2, sample)
+
+		out = protoBytes(out, 1, series)
+	}
+	return out
+}
+
+func protoTag(b []byte, field, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field<<3|wireType))
+}
+
+func protoBytes(b []byte, field int, v []byte) []byte {
+	b = protoTag(b, field, 2)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// snappyEncodeLiteral упаковывает данные в блочный формат snappy одними литералами.
+// Это валидный snappy без сжатия: тела remote-write невелики.
+func snappyEncodeLiteral(src []byte) []byte {
+	out := binary.AppendUvarint(nil, uint64(len(src)))
+	for len(src) > 0 {
+		n := min(len(src), 1<<16)
+		chunk := src[:n]
+		src = src[n:]
+		switch {
+		case n <= 60:
+			out = append(out, byte(n-1)<<2)
+		case n <= 1<<8:
+			out = append(out, 60<<2, byte(n-1))
+		default:
+			out = append(out, 61<<2, byte(n-1), byte((n-1)>>8))
+		}
+		out = append(out, chunk...)
+	}
+	return out
+}
@@ -0,0 +1,357 @@
+package propher
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"propher/internal/config"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// pushRequest - запрос, принятый локальной заменой Pushgateway/Prometheus.
+type pushRequest struct {
+	method  string
+	path    string
+	headers http.Header
+	body    []byte
+}
+
+func newPushServer(t *testing.T, status int) (*httptest.Server, *[]pushRequest) {
+	t.Helper()
+	var got []pushRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = append(got, pushRequest{method: r.Method, path: r.URL.EscapedPath(), headers: r.Header.Clone(), body: body})
+		w.WriteHeader(status)
+		fmt.Fprint(w, "stand-in says hi")
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &got
+}
+
+func testPushStats() measureStatsFile {
+	return measureStatsFile{
+		TotalRead:      10,
+		OK:             9,
+		Bad:            1,
+		DurationSec:    2.5,
+		MessagesInDump: 12,
+		Lost:           2,
+		LostRatio:      2.0 / 12,
+		ServeUs: &distributionStats{
+			Count: 9, Max: 900, Mean: 450.5,
+			Percentiles: map[string]int64{"p50": 400, "p99": 880, "p99.9": 899},
+		},
+		Run: map[string]string{"started_at": "2026-01-02T03:04:05Z"},
+	}
+}
+
+// parsePushText разбирает текстовый формат: "name{labels} value" -> value; TYPE считаются по имени.
+func parsePushText(t *testing.T, body []byte) (map[string]float64, map[string]int) {
+	t.Helper()
+	values := map[string]float64{}
+	types := map[string]int{}
+	for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+		if name, ok := strings.CutPrefix(line, "# TYPE "); ok {
+			name, kind, _ := strings.Cut(name, " ")
+			if kind != "gauge" {
+				t.Errorf("metric %s has type %q, want gauge", name, kind)
+			}
+			types[name]++
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		if i < 0 {
+			t.Fatalf("bad exposition line %q", line)
+		}
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("bad value in %q: %v", line, err)
+		}
+		values[line[:i]] = v
+	}
+	return values, types
+}
+
+// snappyDecode разбирает блочный snappy (литералы и копии).
+func snappyDecode(t *testing.T, src []byte) []byte {
+	t.Helper()
+	n, k := binary.Uvarint(src)
+	if k <= 0 {
+		t.Fatalf("snappy: bad length header")
+	}
+	src = src[k:]
+	var out []byte
+	for len(src) > 0 {
+		tag := src[0]
+		switch tag & 3 {
+		case 0:
+			size := int(tag >> 2)
+			src = src[1:]
+			if size >= 60 {
+				extra := size - 59
+				size = 0
+				for i := 0; i < extra; i++ {
+					size |= int(src[i]) << (8 * i)
+				}
+				src = src[extra:]
+			}
+			size++
+			out = append(out, src[:size]...)
+			src = src[size:]
+		case 1:
+			length := 4 + int(tag>>2&7)
+			offset := int(tag>>5)<<8 | int(src[1])
+			src = src[2:]
+			for i := 0; i < length; i++ {
+				out = append(out, out[len(out)-offset])
+			}
+		case 2:
+			length := 1 + int(tag>>2)
+			offset := int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+			for i := 0; i < length; i++ {
+				out = append(out, out[len(out)-offset])
+			}
+		default:
+			t.Fatalf("snappy: unsupported tag %#x", tag)
+		}
+	}
+	if uint64(len(out)) != n {
+		t.Fatalf("snappy: decoded %d bytes, header says %d", len(out), n)
+	}
+	return out
+}
+
+// protoField - поле protobuf-сообщения.
+type protoField struct {
+	num    int
+	wire   int
+	varint uint64
+	bytes  []byte
+}
+
+func decodeProto(t *testing.T, b []byte) []protoField {
+	t.Helper()
+	var out []protoField
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("proto: bad key")
+		}
+		b = b[n:]
+		f := protoField{num: int(key >> 3), wire: int(key & 7)}
+		switch f.wire {
+		case 0:
+			f.varint, n = binary.Uvarint(b)
+			b = b[n:]
+		case 1:
+			f.varint = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case 2:
+			size, n := binary.Uvarint(b)
+			b = b[n:]
+			f.bytes = b[:size]
+			b = b[size:]
+		default:
+			t.Fatalf("proto: unexpected wire type %d", f.wire)
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// decodedSeries - TimeSeries из WriteRequest.
+type decodedSeries struct {
+	labels []string // name=value по порядку
+	value  float64
+	tsMs   int64
+}
+
+func decodeWriteRequest(t *testing.T, body []byte) []decodedSeries {
+	t.Helper()
+	var out []decodedSeries
+	for _, ts := range decodeProto(t, body) {
+		if ts.num != 1 || ts.wire != 2 {
+			t.Fatalf("WriteRequest: unexpected field %d", ts.num)
+		}
+		var s decodedSeries
+		for _, f := range decodeProto(t, ts.bytes) {
+			switch f.num {
+			case 1:
+				var name, value string
+				for _, lf := range decodeProto(t, f.bytes) {
+					switch lf.num {
+					case 1:
+						name = string(lf.bytes)
+					case 2:
+						value = string(lf.bytes)
+					}
+				}
+				s.labels = append(s.labels, name+"="+value)
+			case 2:
+				for _, sf := range decodeProto(t, f.bytes) {
+					switch {
+					case sf.num == 1 && sf.wire == 1:
+						s.value = math.Float64frombits(sf.varint)
+					case sf.num == 2 && sf.wire == 0:
+						s.tsMs = int64(sf.varint)
+					}
+				}
+			}
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestPushStatsPushgateway(t *testing.T) {
+	srv, got := newPushServer(t, http.StatusOK)
+	cfg := config.PushConfig{URL: srv.URL + "/", Format: "pushgateway", Job: "propher", RunID: "ci/42", Scenario: "smoke"}
+	if err := pushStats(context.Background(), cfg, testPushStats()); err != nil {
+		t.Fatalf("pushStats: %v", err)
+	}
+	if len(*got) != 1 {
+		t.Fatalf("requests = %d, want 1", len(*got))
+	}
+	req := (*got)[0]
+	if req.method != http.MethodPut {
+		t.Errorf("method = %s, want PUT", req.method)
+	}
+	wantPath := "/metrics/job/propher/run_id@base64/" + base64.RawURLEncoding.EncodeToString([]byte("ci/42")) + "/scenario/smoke"
+	if req.path != wantPath {
+		t.Errorf("path = %s, want %s", req.path, wantPath)
+	}
+	if ct := req.headers.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("content type = %q", ct)
+	}
+
+	values, types := parsePushText(t, req.body)
+	for name, want := range map[string]float64{
+		"propher_run_total_read":                 10,
+		"propher_run_ok":                         9,
+		"propher_run_bad":                        1,
+		"propher_run_duration_seconds":           2.5,
+		"propher_run_messages_in_dump":           12,
+		"propher_run_lost":                       2,
+		"propher_run_lost_ratio":                 2.0 / 12,
+		`propher_run_serve_us{quantile="0.5"}`:   400,
+		`propher_run_serve_us{quantile="0.99"}`:  880,
+		`propher_run_serve_us{quantile="0.999"}`: 899,
+		"propher_run_serve_us_mean":              450.5,
+		"propher_run_serve_us_max":               900,
+		"propher_run_serve_us_count":             9,
+		"propher_run_ok_throughput_msg_s":        0,
+		"propher_run_ok_throughput_bytes_s":      0,
+	} {
+		if v, ok := values[name]; !ok || v != want {
+			t.Errorf("%s = %v (present %v), want %v", name, v, ok, want)
+		}
+	}
+	for name, n := range types {
+		if n != 1 {
+			t.Errorf("# TYPE %s written %d times", name, n)
+		}
+	}
+	if _, ok := values["propher_run_latency_us_mean"]; ok {
+		t.Errorf("latency_us pushed without a distribution")
+	}
+}
+
+func TestPushStatsRunIDFallback(t *testing.T) {
+	srv, got := newPushServer(t, http.StatusAccepted)
+	cfg := config.PushConfig{URL: srv.URL, Format: "pushgateway", Job: "j"}
+	if err := pushStats(context.Background(), cfg, testPushStats()); err != nil {
+		t.Fatalf("pushStats: %v", err)
+	}
+	if want := "/metrics/job/j/run_id/2026-01-02T03:04:05Z"; (*got)[0].path != want {
+		t.Errorf("path = %s, want %s", (*got)[0].path, want)
+	}
+}
+
+func TestPushStatsRemoteWrite(t *testing.T) {
+	srv, got := newPushServer(t, http.StatusNoContent)
+	cfg := config.PushConfig{URL: srv.URL + "/api/v1/write", Format: "remote-write", Job: "propher", RunID: "r1", GitCommit: "abc"}
+	if err := pushStats(context.Background(), cfg, testPushStats()); err != nil {
+		t.Fatalf("pushStats: %v", err)
+	}
+	req := (*got)[0]
+	if req.method != http.MethodPost || req.path != "/api/v1/write" {
+		t.Errorf("request = %s %s", req.method, req.path)
+	}
+	for h, want := range map[string]string{
+		"Content-Type":                      "application/x-protobuf",
+		"Content-Encoding":                  "snappy",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+	} {
+		if v := req.headers.Get(h); v != want {
+			t.Errorf("%s = %q, want %q", h, v, want)
+		}
+	}
+
+	series := decodeWriteRequest(t, snappyDecode(t, req.body))
+	if want := len(statsSamples(testPushStats())); len(series) != want {
+		t.Fatalf("series = %d, want %d", len(series), want)
+	}
+	byKey := map[string]decodedSeries{}
+	for _, s := range series {
+		for i := 1; i < len(s.labels); i++ {
+			if s.labels[i-1] >= s.labels[i] {
+				t.Errorf("labels not sorted: %v", s.labels)
+			}
+		}
+		if s.tsMs <= 0 {
+			t.Errorf("series %v has no timestamp", s.labels)
+		}
+		byKey[strings.Join(s.labels, ",")] = s
+	}
+	for key, want := range map[string]float64{
+		"__name__=propher_run_total_read,git_commit=abc,job=propher,run_id=r1":              10,
+		"__name__=propher_run_serve_us,git_commit=abc,job=propher,quantile=0.999,run_id=r1": 899,
+		"__name__=propher_run_lost_ratio,git_commit=abc,job=propher,run_id=r1":              2.0 / 12,
+		"__name__=propher_run_serve_us_mean,git_commit=abc,job=propher,run_id=r1":           450.5,
+	} {
+		s, ok := byKey[key]
+		if !ok {
+			t.Errorf("series %s missing", key)
+			continue
+		}
+		if s.value != want {
+			t.Errorf("series %s = %v, want %v", key, s.value, want)
+		}
+	}
+}
+
+// Тело больше 64 КиБ идет несколькими литералами snappy.
+func TestSnappyEncodeLiteralRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 1, 60, 61, 256, 257, 1 << 16, 1<<16 + 1, 200_000} {
+		src := make([]byte, n)
+		for i := range src {
+			src[i] = byte(i * 7)
+		}
+		if got := snappyDecode(t, snappyEncodeLiteral(src)); string(got) != string(src) {
+			t.Errorf("n=%d: round trip mismatch", n)
+		}
+	}
+}
+
+func TestPushStatsErrors(t *testing.T) {
+	srv, _ := newPushServer(t, http.StatusBadGateway)
+	err := pushStats(context.Background(), config.PushConfig{URL: srv.URL, Format: "pushgateway", Job: "j"}, testPushStats())
+	if err == nil || !strings.Contains(err.Error(), "502") || !strings.Contains(err.Error(), "stand-in says hi") {
+		t.Errorf("non-2xx: err = %v", err)
+	}
+	if err := pushStats(context.Background(), config.PushConfig{URL: srv.URL, Format: "graphite"}, testPushStats()); err == nil {
+		t.Errorf("unknown format: want error")
+	}
+	if err := pushStats(context.Background(), config.PushConfig{}, testPushStats()); err != nil {
+		t.Errorf("disabled push: err = %v", err)
+	}
+}
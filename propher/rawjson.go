@@ -0,0 +1,321 @@
+package propher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Правка JSON-сообщения на уровне байтов: меняются только байты целевого значения,
+// порядок ключей, числа и экранирование остальных полей остаются как в исходнике.
+// Документ должен быть проверен json.Valid до правки.
+
+// jsonSpan - границы значения в документе: doc[start:end].
+type jsonSpan struct {
+	start, end int
+}
+
+func skipJSONSpace(doc []byte, i int) int {
+	for i < len(doc) {
+		switch doc[i] {
+		case ' ', '\t', '\r', '\n':
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// skipJSONString возвращает индекс за закрывающей кавычкой строки, начинающейся в i.
+func skipJSONString(doc []byte, i int) (int, error) {
+	for j := i + 1; j < len(doc); j++ {
+		switch doc[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated string at %d", i)
+}
+
+// skipJSONValue возвращает индекс за значением, начинающимся в i.
+func skipJSONValue(doc []byte, i int) (int, error) {
+	if i >= len(doc) {
+		return 0, fmt.Errorf("unexpected end of json")
+	}
+	switch doc[i] {
+	case '"':
+		return skipJSONString(doc, i)
+	case '{', '[':
+		depth := 0
+		for j := i; j < len(doc); j++ {
+			switch doc[j] {
+			case '"':
+				end, err := skipJSONString(doc, j)
+				if err != nil {
+					return 0, err
+				}
+				j = end - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return j + 1, nil
+				}
+			}
+		}
+		return 0, fmt.Errorf("unterminated container at %d", i)
+	}
+	j := i
+	for j < len(doc) && strings.IndexByte(",}] \t\r\n", doc[j]) < 0 {
+		j++
+	}
+	return j, nil
+}
+
+// jsonKeyEquals сравнивает ключ объекта в JSON-кодировке (с кавычками) с key.
+func jsonKeyEquals(raw []byte, key string) bool {
+	if bytes.IndexByte(raw, '\\') < 0 {
+		return string(raw[1:len(raw)-1]) == key
+	}
+	var s string
+	return json.Unmarshal(raw, &s) == nil && s == key
+}
+
+// jsonObjectMember ищет член объекта в span: member - от ключа до конца значения.
+// Для повторяющихся ключей, как и encoding/json, берется последний.
+func jsonObjectMember(doc []byte, span jsonSpan, key string) (member, value jsonSpan, ok bool, err error) {
+	i := skipJSONSpace(doc, span.start+1)
+	for i < span.end && doc[i] != '}' {
+		keyStart := i
+		keyEnd, err := skipJSONString(doc, i)
+		if err != nil {
+			return member, value, false, err
+		}
+		match := jsonKeyEquals(doc[i:keyEnd], key)
+		i = skipJSONSpace(doc, keyEnd)
+		if i >= span.end || doc[i] != ':' {
+			return member, value, false, fmt.Errorf("expected ':' at %d", i)
+		}
+		i = skipJSONSpace(doc, i+1)
+		end, err := skipJSONValue(doc, i)
+		if err != nil {
+			return member, value, false, err
+		}
+		if match {
+			member, value, ok = jsonSpan{keyStart, end}, jsonSpan{i, end}, true
+		}
+		i = skipJSONSpace(doc, end)
+		if i < span.end && doc[i] == ',' {
+			i = skipJSONSpace(doc, i+1)
+		}
+	}
+	return member, value, ok, nil
+}
+
+// jsonChild ищет значение шага пути внутри объекта или массива в span.
+func jsonChild(doc []byte, span jsonSpan, s pathStep) (jsonSpan, bool, error) {
+	switch doc[span.start] {
+	case '{':
+		if s.isIndex {
+			return jsonSpan{}, false, nil
+		}
+		_, value, ok, err := jsonObjectMember(doc, span, s.key)
+		return value, ok, err
+	case '[':
+		i := skipJSONSpace(doc, span.start+1)
+		for n := 0; i < span.end && doc[i] != ']'; n++ {
+			end, err := skipJSONValue(doc, i)
+			if err != nil {
+				return jsonSpan{}, false, err
+			}
+			if idx, inRange := s.arrayIndex(n + 1); inRange && idx == n {
+				return jsonSpan{i, end}, true, nil
+			}
+			i = skipJSONSpace(doc, end)
+			if i < span.end && doc[i] == ',' {
+				i = skipJSONSpace(doc, i+1)
+			}
+		}
+	}
+	return jsonSpan{}, false, nil
+}
+
+// jsonFieldSteps - шаги пути; ключ верхнего уровня с точкой в имени находится как раньше.
+func jsonFieldSteps(doc []byte, field string) ([]pathStep, error) {
+	plain := []pathStep{{key: field}}
+	if !isFieldPath(field) {
+		return plain, nil
+	}
+	root := jsonSpan{skipJSONSpace(doc, 0), len(doc)}
+	if _, ok, err := jsonChild(doc, root, plain[0]); err != nil || ok {
+		return plain, err
+	}
+	return parseFieldPath(field)
+}
+
+// walkJSON проходит путь и возвращает границы пройденных значений (первое - весь документ)
+// и число найденных шагов.
+func walkJSON(doc []byte, steps []pathStep) ([]jsonSpan, int, error) {
+	start := skipJSONSpace(doc, 0)
+	end, err := skipJSONValue(doc, start)
+	if err != nil {
+		return nil, 0, err
+	}
+	spans := []jsonSpan{{start, end}}
+	for n, s := range steps {
+		next, ok, err := jsonChild(doc, spans[n], s)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !ok {
+			return spans, n, nil
+		}
+		spans = append(spans, next)
+	}
+	return spans, len(steps), nil
+}
+
+// getJSONField возвращает байты значения поля по имени или пути.
+func getJSONField(doc []byte, field string) ([]byte, bool) {
+	steps, err := jsonFieldSteps(doc, field)
+	if err != nil {
+		return nil, false
+	}
+	spans, n, err := walkJSON(doc, steps)
+	if err != nil || n < len(steps) {
+		return nil, false
+	}
+	sp := spans[n]
+	return doc[sp.start:sp.end], true
+}
+
+// jsonRawString - строковое представление значения: строка без кавычек,
+// остальные значения как есть (числа без потери точности), null - пусто.
+func jsonRawString(raw []byte) string {
+	if len(raw) > 0 && raw[0] == '"' {
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			return s
+		}
+	}
+	if string(raw) == "null" {
+		return ""
+	}
+	return string(raw)
+}
+
+// appendJSONString дописывает строку в JSON-кодировке без HTML-экранирования.
+func appendJSONString(dst []byte, s string) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	return append(dst, bytes.TrimRight(buf.Bytes(), "\n")...)
+}
+
+// wrapJSONValue оборачивает значение в объекты по оставшимся ключам пути.
+func wrapJSONValue(steps []pathStep, value []byte) []byte {
+	var out []byte
+	for _, s := range steps {
+		out = append(appendJSONString(append(out, '{'), s.key), ':')
+	}
+	out = append(out, value...)
+	return append(out, bytes.Repeat([]byte{'}'}, len(steps))...)
+}
+
+// splice заменяет doc[start:end] на value в новом срезе.
+func splice(doc []byte, start, end int, value []byte) []byte {
+	out := make([]byte, 0, len(doc)-(end-start)+len(value))
+	out = append(out, doc[:start]...)
+	out = append(out, value...)
+	return append(out, doc[end:]...)
+}
+
+// setJSONField записывает готовое JSON-значение по имени или пути.
+// Недостающие объекты создаются (новый ключ добавляется в конец объекта), null заменяется объектом;
+// массивы не создаются и не расширяются.
+func setJSONField(doc []byte, field string, value []byte) ([]byte, error) {
+	steps, err := jsonFieldSteps(doc, field)
+	if err != nil {
+		return nil, err
+	}
+	spans, n, err := walkJSON(doc, steps)
+	if err != nil {
+		return nil, err
+	}
+	at := spans[n]
+	if n == len(steps) {
+		return splice(doc, at.start, at.end, value), nil
+	}
+	for _, s := range steps[n:] {
+		if s.isIndex {
+			return nil, fmt.Errorf("%s: missing array element %s", field, s)
+		}
+	}
+	switch {
+	case n > 0 && string(doc[at.start:at.end]) == "null":
+		return splice(doc, at.start, at.end, wrapJSONValue(steps[n:], value)), nil
+	case doc[at.start] == '{':
+		// Вставка перед закрывающей скобкой; запятая, если объект не пуст.
+		closing := at.end - 1
+		member := appendJSONString(nil, steps[n].key)
+		member = append(append(member, ':'), wrapJSONValue(steps[n+1:], value)...)
+		if last := bytes.TrimRight(doc[at.start+1:closing], " \t\r\n"); len(last) > 0 {
+			member = append([]byte{','}, member...)
+		}
+		return splice(doc, closing, closing, member), nil
+	case doc[at.start] == '[':
+		return nil, fmt.Errorf("%s: array index %s out of range", field, steps[n])
+	}
+	return nil, fmt.Errorf("%s: %s is not an object or array", field, doc[at.start:at.end])
+}
+
+// deleteJSONField удаляет член объекта по имени или пути вместе с разделителем;
+// повторяющиеся ключи удаляются все. Отсутствующее поле - не ошибка (false);
+// элементы массивов не удаляются.
+func deleteJSONField(doc []byte, field string) ([]byte, bool, error) {
+	steps, err := jsonFieldSteps(doc, field)
+	if err != nil {
+		return nil, false, err
+	}
+	last := steps[len(steps)-1]
+	spans, n, err := walkJSON(doc, steps[:len(steps)-1])
+	if err != nil || n < len(steps)-1 {
+		return doc, false, err
+	}
+	parent := spans[n]
+	if last.isIndex || doc[parent.start] != '{' {
+		return doc, false, nil
+	}
+	deleted := false
+	for {
+		member, _, ok, err := jsonObjectMember(doc, parent, last.key)
+		if err != nil {
+			return doc, false, err
+		}
+		if !ok {
+			return doc, deleted, nil
+		}
+		// Запятая после члена, а у последнего члена - перед ним.
+		start, end := member.start, member.end
+		if j := skipJSONSpace(doc, end); doc[j] == ',' {
+			end = skipJSONSpace(doc, j+1)
+		} else {
+			i := start - 1
+			for i > parent.start && strings.IndexByte(" \t\r\n", doc[i]) >= 0 {
+				i--
+			}
+			if doc[i] == ',' {
+				start = i
+			}
+		}
+		doc = splice(doc, start, end, nil)
+		parent.end -= end - start
+		deleted = true
+	}
+}
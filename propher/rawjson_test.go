@@ -0,0 +1,213 @@
+package propher
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestGetJSONField(t *testing.T) {
+	tests := []struct {
+		name, doc, field string
+		want             string
+		ok               bool
+	}{
+		{"top level", `{"a":1,"b":"x"}`, "b", `"x"`, true},
+		{"missing", `{"a":1}`, "b", "", false},
+		{"escaped quote in key", `{"a\"b":1,"ab":2}`, `a"b`, "1", true},
+		{"escaped backslash in key", `{"a\\":1,"a":2}`, `a\`, "1", true},
+		{"unicode escape in key", `{"\u0061":1}`, "a", "1", true},
+		{"escaped quote in value", `{"a":"x\"}","b":2}`, "b", "2", true},
+		{"backslash before closing quote", `{"a":"x\\","b":2}`, "b", "2", true},
+		{"brackets inside strings", `{"a":{"s":"}]{[","t":3},"b":4}`, "a.t", "3", true},
+		{"nested object", `{"meta":{"timing":{"sent":17}}}`, "meta.timing.sent", "17", true},
+		{"json pointer", `{"meta":{"timing":{"sent":17}}}`, "/meta/timing/sent", "17", true},
+		{"pointer escapes", `{"a/b":{"c~d":5}}`, "/a~1b/c~0d", "5", true},
+		{"array index", `{"items":[{"id":"x"},{"id":"y"}]}`, "items[1].id", `"y"`, true},
+		{"nested arrays", `{"m":[[1,2],[3,[4,5]]]}`, "m[1][1][0]", "4", true},
+		{"dotted index", `{"items":[10,20]}`, "items.1", "20", true},
+		{"index out of range", `{"items":[10,20]}`, "items[2]", "", false},
+		{"index on object", `{"items":{"0":1}}`, "items[0]", "", false},
+		{"key on array", `{"items":[1]}`, "items.id", "", false},
+		{"path through scalar", `{"meta":5}`, "meta.ts", "", false},
+		{"path through null", `{"meta":null}`, "meta.ts", "", false},
+		{"duplicate keys take last", `{"a":1,"a":2}`, "a", "2", true},
+		{"duplicate parents take last", `{"m":{"x":1},"m":{"y":2}}`, "m.x", "", false},
+		{"dotted top-level key wins", `{"a.b":1,"a":{"b":2}}`, "a.b", "1", true},
+		{"dotted key falls back to path", `{"a":{"b":2}}`, "a.b", "2", true},
+		{"whitespace", " {\n\t\"a\" : { \"b\" :\r\n[ 1 , 2 ] } } ", "a.b[1]", "2", true},
+		{"empty object", `{}`, "a", "", false},
+		{"null value", `{"a":null}`, "a", "null", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := getJSONField([]byte(tt.doc), tt.field)
+			if ok != tt.ok || string(got) != tt.want {
+				t.Errorf("getJSONField(%s, %q) = %s, %v; want %s, %v", tt.doc, tt.field, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSetJSONField(t *testing.T) {
+	tests := []struct {
+		name, doc, field, value string
+		want                    string
+	}{
+		{"replace", `{"a":1,"b":2}`, "a", `"x"`, `{"a":"x","b":2}`},
+		{"keep numbers and order", `{"z":1.50,"n":12345678901234567890,"a":1}`, "a", "2", `{"z":1.50,"n":12345678901234567890,"a":2}`},
+		{"append", `{"a":1}`, "b", "2", `{"a":1,"b":2}`},
+		{"empty object", `{}`, "a", "1", `{"a":1}`},
+		{"empty object with space", `{ }`, "a", "1", `{ "a":1}`},
+		{"whitespace before brace", "{\"a\":1 \n}", "b", "2", "{\"a\":1 \n,\"b\":2}"},
+		{"escaped key", `{"a\"b":1}`, `a"b`, "2", `{"a\"b":2}`},
+		{"new escaped key", `{}`, `a"b`, "2", `{"a\"b":2}`},
+		{"escaped values around", `{"s":"x\\\"}","a":1,"t":"é"}`, "a", "2", `{"s":"x\\\"}","a":2,"t":"é"}`},
+		{"nested", `{"meta":{"ts":1,"x":2}}`, "meta.ts", "9", `{"meta":{"ts":9,"x":2}}`},
+		{"create parents", `{"a":1}`, "meta.timing.sent", "5", `{"a":1,"meta":{"timing":{"sent":5}}}`},
+		{"create in nested", `{"meta":{"x":1}}`, "meta.timing.sent", "5", `{"meta":{"x":1,"timing":{"sent":5}}}`},
+		{"null parent", `{"meta":null,"b":1}`, "meta.ts", "5", `{"meta":{"ts":5},"b":1}`},
+		{"null parent deep", `{"meta":null}`, "meta.a.b", "5", `{"meta":{"a":{"b":5}}}`},
+		{"null leaf", `{"a":null}`, "a", "1", `{"a":1}`},
+		{"array element", `{"items":[{"id":1},{"id":2}]}`, "items[1].id", "7", `{"items":[{"id":1},{"id":7}]}`},
+		{"array element field", `{"items":[{"id":1}]}`, "items[0].ts", "7", `{"items":[{"id":1,"ts":7}]}`},
+		{"replace container", `{"a":{"b":[1,{"c":2}]},"d":3}`, "a", "0", `{"a":0,"d":3}`},
+		{"duplicate keys set last", `{"a":1,"a":2}`, "a", "3", `{"a":1,"a":3}`},
+		{"dotted top-level key", `{"a.b":1,"a":{"b":2}}`, "a.b", "3", `{"a.b":3,"a":{"b":2}}`},
+		{"dotted path", `{"a":{"b":2}}`, "a.b", "3", `{"a":{"b":3}}`},
+		{"pointer", `{"a/b":1}`, "/a~1b", "3", `{"a/b":3}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := setJSONField([]byte(tt.doc), tt.field, []byte(tt.value))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("setJSONField(%s, %q, %s) = %s, want %s", tt.doc, tt.field, tt.value, got, tt.want)
+			}
+			if !json.Valid(got) {
+				t.Errorf("invalid json: %s", got)
+			}
+			if v, ok := getJSONField(got, tt.field); !ok || string(v) != tt.value {
+				t.Errorf("read back %q = %s, %v", tt.field, v, ok)
+			}
+		})
+	}
+}
+
+func TestSetJSONFieldErrors(t *testing.T) {
+	for _, tt := range []struct{ doc, field string }{
+		{`{"meta":5}`, "meta.ts"},
+		{`{"meta":"x"}`, "meta.ts"},
+		{`{"items":[1]}`, "items[3]"},
+		{`{"items":[1]}`, "items.id"},
+		{`{}`, "items[0]"},
+		{`{}`, "items[0].id"},
+		{`{"a":1}`, "b..c"},
+	} {
+		if got, err := setJSONField([]byte(tt.doc), tt.field, []byte("1")); err == nil {
+			t.Errorf("setJSONField(%s, %q) = %s, want error", tt.doc, tt.field, got)
+		}
+	}
+}
+
+func TestDeleteJSONField(t *testing.T) {
+	tests := []struct {
+		name, doc, field string
+		want             string
+		ok               bool
+	}{
+		{"first", `{"a":1,"b":2,"c":3}`, "a", `{"b":2,"c":3}`, true},
+		{"middle", `{"a":1,"b":2,"c":3}`, "b", `{"a":1,"c":3}`, true},
+		{"last", `{"a":1,"b":2,"c":3}`, "c", `{"a":1,"b":2}`, true},
+		{"only", `{"a":1}`, "a", `{}`, true},
+		{"spaces", `{ "a" : 1 , "b" : 2 }`, "b", `{ "a" : 1  }`, true},
+		{"nested", `{"meta":{"x":{"y":1},"pii":"z"},"b":2}`, "meta.pii", `{"meta":{"x":{"y":1}},"b":2}`, true},
+		{"escaped key", `{"a\"b":1,"c":2}`, `a"b`, `{"c":2}`, true},
+		{"container value", `{"a":[1,{"b":"]}"}],"c":2}`, "a", `{"c":2}`, true},
+		{"missing", `{"a":1}`, "b", `{"a":1}`, false},
+		{"missing parent", `{"a":1}`, "m.b", `{"a":1}`, false},
+		{"null parent", `{"m":null}`, "m.b", `{"m":null}`, false},
+		{"array element", `{"items":[1,2]}`, "items[0]", `{"items":[1,2]}`, false},
+		{"in array element", `{"items":[{"id":1,"x":2}]}`, "items[0].x", `{"items":[{"id":1}]}`, true},
+		{"dotted top-level key", `{"a.b":1,"a":{"b":2}}`, "a.b", `{"a":{"b":2}}`, true},
+		{"duplicate keys", `{"pii":"x","a":1,"pii":"y"}`, "pii", `{"a":1}`, true},
+		{"only duplicates", `{ "pii":"x" , "pii":"y" }`, "pii", `{   }`, true},
+		{"nested duplicates", `{"m":{"k":1,"k":2,"j":3}}`, "m.k", `{"m":{"j":3}}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := deleteJSONField([]byte(tt.doc), tt.field)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.ok || string(got) != tt.want {
+				t.Errorf("deleteJSONField(%s, %q) = %s, %v; want %s, %v", tt.doc, tt.field, got, ok, tt.want, tt.ok)
+			}
+			if !json.Valid(got) {
+				t.Errorf("invalid json: %s", got)
+			}
+		})
+	}
+}
+
+// TestSetJSONFieldKeepsOtherBytes проверяет, что правка меняет только байты целевого значения.
+func TestSetJSONFieldKeepsOtherBytes(t *testing.T) {
+	doc := []byte("{\n  \"id\": \"m\\u00e9-1\",\n  \"n\": 1.000e+3,\n  \"meta\": {\"ts\" : 17, \"tags\": [\"a\", \"b\\\"c\"]},\n  \"html\": \"<a&b>\",\n  \"big\": 123456789012345678901234567890\n}")
+	for _, field := range []string{"id", "n", "meta", "meta.ts", "meta.tags[1]", "/meta/tags/0", "html", "big"} {
+		steps, err := jsonFieldSteps(doc, field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spans, n, err := walkJSON(doc, steps)
+		if err != nil || n != len(steps) {
+			t.Fatalf("%s: walk = %d/%d, %v", field, n, len(steps), err)
+		}
+		span := spans[n]
+		value := []byte(`"<new>"`)
+		got, err := setJSONField(doc, field, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prefix, suffix := doc[:span.start], doc[span.end:]
+		if !bytes.HasPrefix(got, prefix) || !bytes.HasSuffix(got, suffix) ||
+			!bytes.Equal(got[len(prefix):len(got)-len(suffix)], value) {
+			t.Errorf("%s: bytes outside %d..%d changed:\n%s", field, span.start, span.end, got)
+		}
+
+		// Остальные поля после декодирования совпадают с исходными.
+		var before, after map[string]any
+		if err := json.Unmarshal(doc, &before); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(got, &after); err != nil {
+			t.Fatalf("%s: %v", field, err)
+		}
+		for k := range before {
+			if k != steps[0].key && !reflect.DeepEqual(before[k], after[k]) {
+				t.Errorf("%s: field %s changed: %v -> %v", field, k, before[k], after[k])
+			}
+		}
+	}
+}
+
+func TestJSONRawString(t *testing.T) {
+	for raw, want := range map[string]string{
+		`"a\"b"`:               `a"b`,
+		`"é"`:                  "é",
+		`12345678901234567890`: "12345678901234567890",
+		`1.50`:                 "1.50",
+		`null`:                 "",
+		`true`:                 "true",
+		`{"a":1}`:              `{"a":1}`,
+	} {
+		if got := jsonRawString([]byte(raw)); got != want {
+			t.Errorf("jsonRawString(%s) = %q, want %q", raw, got, want)
+		}
+	}
+	if got := string(appendJSONString(nil, `<a&"b">`)); got != `"<a&\"b\">"` {
+		t.Errorf("appendJSONString = %s", got)
+	}
+}
@@ -0,0 +1,148 @@
+package propher
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+)
+
+// scanRecordsFile построчно читает latency.jsonl и передает записи в fn.
+// Возвращает число нераспознанных строк.
+func scanRecordsFile(path string, fn func(Record) error) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("open records file: %w", err)
+	}
+	defer f.Close()
+
+	scan := bufio.NewScanner(f)
+	buf := make([]byte, 0, 1024*1024)
+	scan.Buffer(buf, 32*1024*1024)
+
+	bad := 0
+	for scan.Scan() {
+		line := bytes.TrimSpace(scan.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			bad++
+			continue
+		}
+		if err := fn(rec); err != nil {
+			return bad, err
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return bad, fmt.Errorf("scan records file: %w", err)
+	}
+	return bad, nil
+}
+
+// recordAggregator пересчитывает статистику прогона по записям.
+type recordAggregator struct {
+	digits    int
+	quantiles []float64
+
+	total       int
+	okCount     int
+	okBytes     int64
+	badCount    int
+	serveHist   *hdrHistogram
+	latHist     *hdrHistogram
+	processHist *hdrHistogram
+	firstReadUs int64
+	lastReadUs  int64
+	groups      *groupAggregator
+	sizes       *sizeAggregator
+	stages      *stageAggregator
+}
+
+func newRecordAggregator(digits int, quantiles []float64) *recordAggregator {
+	return &recordAggregator{
+		digits:      digits,
+		quantiles:   quantiles,
+		serveHist:   newHDRHistogram(digits),
+		latHist:     newHDRHistogram(digits),
+		processHist: newHDRHistogram(digits),
+		firstReadUs: math.MaxInt64,
+	}
+}
+
+// add учитывает запись; исключенные окнами записи пропускаются.
+func (a *recordAggregator) add(rec Record) {
+	if rec.Excluded != "" {
+		return
+	}
+	a.total++
+	if a.groups != nil {
+		a.groups.observe(rec)
+	}
+	if a.sizes != nil {
+		a.sizes.observe(rec)
+	}
+	if a.stages != nil {
+		a.stages.observe(rec)
+	}
+	if rec.ProcessUs != nil {
+		a.processHist.Record(*rec.ProcessUs)
+	}
+	if !rec.OK || rec.ServeUs == nil || rec.LatencyUs == nil {
+		a.badCount++
+		return
+	}
+	a.okCount++
+	a.okBytes += int64(rec.ResultBytes)
+	a.serveHist.Record(*rec.ServeUs)
+	a.latHist.Record(*rec.LatencyUs)
+	if rec.ResultSentUs != nil {
+		readUs := *rec.ResultSentUs + *rec.LatencyUs
+		a.firstReadUs = min(a.firstReadUs, readUs)
+		a.lastReadUs = max(a.lastReadUs, readUs)
+	}
+}
+
+// durationSec - окно чтения между первой и последней успешной записью.
+func (a *recordAggregator) durationSec() float64 {
+	if a.lastReadUs <= a.firstReadUs {
+		return 0
+	}
+	return float64(a.lastReadUs-a.firstReadUs) / 1_000_000.0
+}
+
+// stats собирает stats-файл; потери по latency.jsonl неизвестны.
+func (a *recordAggregator) stats(withBuckets bool) measureStatsFile {
+	durS := a.durationSec()
+	throughput, throughputBytes := 0.0, 0.0
+	if durS > 0 {
+		throughput = float64(a.okCount) / durS
+		throughputBytes = float64(a.okBytes) / durS
+	}
+	stats := measureStatsFile{
+		TotalRead:          a.total,
+		OK:                 a.okCount,
+		Bad:                a.badCount,
+		DurationSec:        durS,
+		OKThroughputMsgS:   throughput,
+		OKThroughputBytesS: throughputBytes,
+		ServeUs:            summarizeHistogram(a.serveHist, a.quantiles, withBuckets),
+		LatencyUs:          summarizeHistogram(a.latHist, a.quantiles, withBuckets),
+		ProcessUs:          summarizeHistogram(a.processHist, a.quantiles, withBuckets),
+	}
+	if a.groups != nil {
+		stats.GroupBy = a.groups.columns()
+		stats.Groups = a.groups.summary(a.quantiles, durS)
+	}
+	if a.sizes != nil {
+		stats.SizeBucketBy = a.sizes.by
+		stats.SizeBuckets = a.sizes.summary(a.quantiles, durS)
+	}
+	if a.stages != nil {
+		stats.Stages = a.stages.summary(a.quantiles)
+	}
+	return stats
+}
@@ -0,0 +1,207 @@
+package propher
+
+import (
+	"context"
+	"fmt"
+	"propher/internal/config"
+	"regexp"
+	"strings"
+)
+
+// recordFilter отбирает записи для офлайн-отчета.
+type recordFilter struct {
+	fromUs          *int64
+	toUs            *int64
+	okOnly          bool
+	idPattern       *regexp.Regexp
+	includeExcluded bool
+}
+
+func newRecordFilter(reportCfg config.ReportConfig) (*recordFilter, error) {
+	f := &recordFilter{
+		okOnly:          reportCfg.OKOnly,
+		includeExcluded: reportCfg.IncludeExcluded,
+	}
+	if s := strings.TrimSpace(reportCfg.From); s != "" {
+		v, err := parseEpochFlag(s, "auto")
+		if err != nil {
+			return nil, fmt.Errorf("from: %w", err)
+		}
+		f.fromUs = v
+	}
+	if s := strings.TrimSpace(reportCfg.To); s != "" {
+		v, err := parseEpochFlag(s, "auto")
+		if err != nil {
+			return nil, fmt.Errorf("to: %w", err)
+		}
+		f.toUs = v
+	}
+	if reportCfg.IDPattern != "" {
+		re, err := regexp.Compile(reportCfg.IDPattern)
+		if err != nil {
+			return nil, fmt.Errorf("id-pattern: %w", err)
+		}
+		f.idPattern = re
+	}
+	return f, nil
+}
+
+// recordReadUs восстанавливает момент чтения записи из очереди.
+func recordReadUs(rec Record) (int64, bool) {
+	if rec.ResultSentUs == nil {
+		return 0, false
+	}
+	if rec.LatencyUs == nil {
+		return *rec.ResultSentUs, true
+	}
+	return *rec.ResultSentUs + *rec.LatencyUs, true
+}
+
+func (f *recordFilter) match(rec Record) bool {
+	if f.okOnly && !rec.OK {
+		return false
+	}
+	if f.idPattern != nil && !f.idPattern.MatchString(rec.MessageID) {
+		return false
+	}
+	if f.fromUs != nil || f.toUs != nil {
+		readUs, ok := recordReadUs(rec)
+		if !ok {
+			return false
+		}
+		if f.fromUs != nil && readUs < *f.fromUs {
+			return false
+		}
+		if f.toUs != nil && readUs > *f.toUs {
+			return false
+		}
+	}
+	return true
+}
+
+// buildReportStatsPath строит путь отчета рядом с первым файлом записей.
+func buildReportStatsPath(recordsPath string) string {
+	trimmed := strings.TrimSpace(recordsPath)
+	if strings.HasSuffix(trimmed, ".jsonl") {
+		return strings.TrimSuffix(trimmed, ".jsonl") + ".report.stats.json"
+	}
+	return trimmed + ".report.stats.json"
+}
+
+// RunReport пересчитывает stats-файл по одному или нескольким latency.jsonl.
+func RunReport(cfg *config.Config) error {
+	reportCfg := cfg.Report
+	measureCfg := cfg.MeasureListLatency
+	if len(reportCfg.Files) == 0 {
+		return fmt.Errorf("report needs at least one records file")
+	}
+	if measureCfg.HistPrecision < 1 || measureCfg.HistPrecision > 5 {
+		return fmt.Errorf("hist-precision must be between 1 and 5")
+	}
+	quantiles, err := parsePercentiles(measureCfg.Percentiles)
+	if err != nil {
+		return fmt.Errorf("percentiles: %w", err)
+	}
+	filter, err := newRecordFilter(reportCfg)
+	if err != nil {
+		return err
+	}
+
+	groupFields, err := parseExtraFields(measureCfg.GroupBy)
+	if err != nil {
+		return fmt.Errorf("group-by: %w", err)
+	}
+	sizeBounds, err := parseSizeBuckets(measureCfg.SizeBuckets)
+	if err != nil {
+		return fmt.Errorf("size-buckets: %w", err)
+	}
+	stages, err := parseStages(measureCfg.Stages, measureCfg.T0Unit)
+	if err != nil {
+		return fmt.Errorf("stages: %w", err)
+	}
+
+	agg := newRecordAggregator(measureCfg.HistPrecision, quantiles)
+	agg.groups = newGroupAggregator(groupFields, measureCfg.GroupByMax, measureCfg.HistPrecision)
+	agg.stages = newStageAggregator(stages, measureCfg.HistPrecision)
+	agg.sizes, err = newSizeAggregator(sizeBounds, measureCfg.SizeBucketBy, measureCfg.HistPrecision)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]struct{}, 1024)
+	matched := 0
+	for _, path := range reportCfg.Files {
+		bad, err := scanRecordsFile(path, func(rec Record) error {
+			// Сообщение получено, даже если его запись не прошла фильтры: иначе окно
+			// -from/-to или -ok-only записывает в потери все сообщения вне отбора.
+			if rec.MessageID != "" {
+				seen[rec.MessageID] = struct{}{}
+			}
+			if !filter.match(rec) {
+				return nil
+			}
+			matched++
+			if filter.includeExcluded {
+				rec.Excluded = ""
+			}
+			agg.add(rec)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		measureLogger.Printf("[REPORT] path=%s unparsed_lines=%d", path, bad)
+	}
+
+	stats := agg.stats(measureCfg.StatsHistogram)
+
+	// Потери считаем только при наличии исходного дампа.
+	if measureCfg.SourceDump != "" {
+		sourceIndex, sourceStats, err := loadSourceIndex(
+			measureCfg.SourceDump,
+			measureCfg.MessageIDField,
+			measureCfg.SourceSentField,
+			measureCfg.SourceSentUnit,
+		)
+		if err != nil {
+			return err
+		}
+		measureLogger.Printf("[SOURCE] lines=%d indexed=%d bad=%d dup=%d",
+			sourceStats.Total, sourceStats.Indexed, sourceStats.Bad, sourceStats.Duplicates)
+		var lostIDs []string
+		for msgID := range sourceIndex {
+			if _, ok := seen[msgID]; !ok {
+				lostIDs = append(lostIDs, msgID)
+			}
+		}
+		stats.MessagesInDump = len(sourceIndex)
+		stats.Lost = len(lostIDs)
+		if len(sourceIndex) > 0 {
+			stats.LostRatio = float64(len(lostIDs)) / float64(len(sourceIndex))
+		}
+		if agg.groups != nil {
+			agg.groups.countLost(sourceIndex, lostIDs)
+			stats.Groups = agg.groups.summary(quantiles, stats.DurationSec)
+		}
+	}
+
+	measureLogger.Printf("[RESULT] matched=%d total_read=%d ok=%d bad=%d duration_s=%.3f ok_throughput_msg_s=%.3f ok_throughput_bytes_s=%.0f",
+		matched, stats.TotalRead, stats.OK, stats.Bad, stats.DurationSec, stats.OKThroughputMsgS, stats.OKThroughputBytesS)
+	logDistribution("SERVE", stats.ServeUs)
+	logDistribution("LAT", stats.LatencyUs)
+	logGroups(stats.Groups)
+	logSizeBuckets(stats.SizeBucketBy, stats.SizeBuckets)
+	logStages(stats.Stages)
+
+	outPath := reportCfg.Out
+	if outPath == "" {
+		outPath = buildReportStatsPath(reportCfg.Files[0])
+	}
+	if err := writeStatsJSON(outPath, stats); err != nil {
+		return err
+	}
+	measureLogger.Printf("[STATS] path=%s", outPath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+	return pushStats(ctx, cfg.Push, stats)
+}
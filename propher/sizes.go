@@ -0,0 +1,147 @@
+package propher
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	sizeBySource = "source"
+	sizeByResult = "result"
+)
+
+// sizeBucketStats - статистика записей одного диапазона размера сообщения.
+type sizeBucketStats struct {
+	Bucket    string `json:"bucket"`
+	FromBytes int    `json:"from_bytes"`
+	// ToBytes - верхняя граница (не включительно); 0 для последнего открытого диапазона.
+	ToBytes  int     `json:"to_bytes,omitempty"`
+	AvgBytes float64 `json:"avg_bytes"`
+	windowStats
+	OKThroughputMsgS   float64 `json:"ok_throughput_msg_s"`
+	OKThroughputBytesS float64 `json:"ok_throughput_bytes_s"`
+}
+
+// parseSizeBuckets разбирает возрастающие границы диапазонов в байтах, например "1024,4096".
+func parseSizeBuckets(s string) ([]int, error) {
+	var out []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		v, err := strconv.Atoi(part)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("bad size bucket bound %q", part)
+		}
+		if len(out) > 0 && v <= out[len(out)-1] {
+			return nil, fmt.Errorf("size bucket bounds must be increasing: %d after %d", v, out[len(out)-1])
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// sizeAggregator разбивает записи по размеру исходного или результирующего сообщения.
+type sizeAggregator struct {
+	bounds  []int
+	by      string
+	buckets []*windowGroup
+	bytes   []int64
+	okBytes []int64
+}
+
+// newSizeAggregator возвращает nil, если границы не заданы.
+func newSizeAggregator(bounds []int, by string, digits int) (*sizeAggregator, error) {
+	if by != sizeBySource && by != sizeByResult {
+		return nil, fmt.Errorf("unknown size-bucket-by %q (want source or result)", by)
+	}
+	if len(bounds) == 0 {
+		return nil, nil
+	}
+	s := &sizeAggregator{
+		bounds:  bounds,
+		by:      by,
+		buckets: make([]*windowGroup, len(bounds)+1),
+		bytes:   make([]int64, len(bounds)+1),
+		okBytes: make([]int64, len(bounds)+1),
+	}
+	for i := range s.buckets {
+		s.buckets[i] = newWindowGroup(digits)
+	}
+	return s, nil
+}
+
+// size возвращает размер, по которому раскладывается запись; 0 - неизвестен.
+func (s *sizeAggregator) size(rec Record) int {
+	if s.by == sizeByResult {
+		return rec.ResultBytes
+	}
+	return rec.SourceBytes
+}
+
+// observe учитывает запись; записи без известного размера пропускаются.
+func (s *sizeAggregator) observe(rec Record) {
+	size := s.size(rec)
+	if size <= 0 {
+		return
+	}
+	i := sort.Search(len(s.bounds), func(i int) bool { return size < s.bounds[i] })
+	s.buckets[i].observe(rec)
+	s.bytes[i] += int64(size)
+	if rec.OK {
+		s.okBytes[i] += int64(size)
+	}
+}
+
+// summary собирает непустые диапазоны по возрастанию; durS - окно для пропускной способности.
+func (s *sizeAggregator) summary(quantiles []float64, durS float64) []sizeBucketStats {
+	var out []sizeBucketStats
+	for i, grp := range s.buckets {
+		if grp.count == 0 {
+			continue
+		}
+		st := sizeBucketStats{
+			AvgBytes: float64(s.bytes[i]) / float64(grp.count),
+			windowStats: windowStats{
+				Count: grp.count,
+				OK:    grp.okCount,
+				Bad:   grp.badCount,
+			},
+		}
+		if i > 0 {
+			st.FromBytes = s.bounds[i-1]
+		}
+		if i < len(s.bounds) {
+			st.ToBytes = s.bounds[i]
+			st.Bucket = fmt.Sprintf("%d-%d", st.FromBytes, st.ToBytes-1)
+		} else {
+			st.Bucket = fmt.Sprintf("%d+", st.FromBytes)
+		}
+		if grp.okCount > 0 {
+			st.ServeUs = summarizeHistogram(grp.serveHist, quantiles, false)
+			st.LatencyUs = summarizeHistogram(grp.latHist, quantiles, false)
+		}
+		if durS > 0 {
+			st.OKThroughputMsgS = float64(grp.okCount) / durS
+			st.OKThroughputBytesS = float64(s.okBytes[i]) / durS
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// logSizeBuckets печатает строку [SIZE] на каждый непустой диапазон.
+func logSizeBuckets(by string, buckets []sizeBucketStats) {
+	for _, st := range buckets {
+		serveP99, latP99 := "n/a", "n/a"
+		if st.ServeUs != nil {
+			serveP99 = strconv.FormatInt(st.ServeUs.P99, 10)
+			latP99 = strconv.FormatInt(st.LatencyUs.P99, 10)
+		}
+		measureLogger.Printf("[SIZE] by=%s bucket=%s count=%d ok=%d bad=%d avg_bytes=%.0f ok_throughput_bytes_s=%.0f serve_p99=%s latency_p99=%s",
+			by, st.Bucket, st.Count, st.OK, st.Bad, st.AvgBytes, st.OKThroughputBytesS, serveP99, latP99)
+	}
+}
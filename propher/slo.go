@@ -0,0 +1,282 @@
+package propher
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// SLOViolationError возвращается, если хотя бы одна SLO-проверка не прошла.
+type SLOViolationError struct {
+	Failed int
+	Total  int
+}
+
+func (e *SLOViolationError) Error() string {
+	return fmt.Sprintf("slo violated: %d of %d checks failed", e.Failed, e.Total)
+}
+
+// sloCheck - одно пороговое выражение вида serve_us.p99<=5000.
+type sloCheck struct {
+	Expr      string
+	Metric    string
+	Op        string
+	Threshold float64
+}
+
+// sloResult - результат проверки выражения на stats-файле.
+type sloResult struct {
+	sloCheck
+	Value float64
+	Found bool
+	Pass  bool
+}
+
+// Операторы в порядке разбора: двухсимвольные раньше односимвольных.
+var sloOperators = []string{"<=", ">=", "==", "!=", "<", ">"}
+
+var sloDistributions = map[string]bool{
+	"serve_us":   true,
+	"latency_us": true,
+	"process_us": true,
+}
+
+// parseSLOCheck разбирает выражение "<metric> <op> <number>"; labels - доступные метки персентилей.
+func parseSLOCheck(expr string, labels map[string]bool) (sloCheck, error) {
+	trimmed := strings.TrimSpace(expr)
+	for _, op := range sloOperators {
+		idx := strings.Index(trimmed, op)
+		if idx < 0 {
+			continue
+		}
+		metric := strings.TrimSpace(trimmed[:idx])
+		value := strings.TrimSpace(trimmed[idx+len(op):])
+		if metric == "" || value == "" {
+			return sloCheck{}, fmt.Errorf("bad slo expression %q", expr)
+		}
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return sloCheck{}, fmt.Errorf("bad slo threshold in %q: %w", expr, err)
+		}
+		if err := validateSLOMetric(metric, labels); err != nil {
+			return sloCheck{}, err
+		}
+		return sloCheck{
+			Expr:      metric + " " + op + " " + value,
+			Metric:    metric,
+			Op:        op,
+			Threshold: threshold,
+		}, nil
+	}
+	return sloCheck{}, fmt.Errorf("slo expression %q has no operator", expr)
+}
+
+// validateSLOMetric проверяет имя метрики; персентиль должен быть среди тех, что попадут в stats-файл.
+func validateSLOMetric(metric string, labels map[string]bool) error {
+	switch metric {
+	case "total_read", "ok", "bad", "lost", "lost_ratio", "duration_sec", "ok_throughput_msg_s", "ok_throughput_bytes_s":
+		return nil
+	}
+	dist, stat, ok := strings.Cut(metric, ".")
+	if !ok || !sloDistributions[dist] {
+		return fmt.Errorf("unknown slo metric %q", metric)
+	}
+	switch stat {
+	case "count", "min", "max", "mean", "stddev":
+		return nil
+	}
+	if !strings.HasPrefix(stat, "p") {
+		return fmt.Errorf("unknown slo metric %q", metric)
+	}
+	if !labels[stat] {
+		have := make([]string, 0, len(labels))
+		for label := range labels {
+			have = append(have, label)
+		}
+		sortPercentileLabels(have)
+		return fmt.Errorf("slo metric %q: percentile %s is not computed (have %s; add it to -percentiles)", metric, stat, strings.Join(have, ", "))
+	}
+	return nil
+}
+
+// sloPercentileLabels - метки персентилей в stats-файле: постоянные p50..p99 и -percentiles.
+func sloPercentileLabels(quantiles []float64) map[string]bool {
+	labels := map[string]bool{"p50": true, "p90": true, "p95": true, "p99": true}
+	for _, q := range quantiles {
+		labels[percentileLabel(q)] = true
+	}
+	return labels
+}
+
+// loadSLOChecks собирает выражения из флагов и файла (по одному на строку, # - комментарий).
+// Метрики проверяются до прогона: персентиль вне quantiles после прогона был бы n/a.
+func loadSLOChecks(exprs []string, path string, quantiles []float64) ([]sloCheck, error) {
+	all := append([]string(nil), exprs...)
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("open slo file: %w", err)
+		}
+		defer f.Close()
+		scan := bufio.NewScanner(f)
+		for scan.Scan() {
+			line := strings.TrimSpace(scan.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			all = append(all, line)
+		}
+		if err := scan.Err(); err != nil {
+			return nil, fmt.Errorf("scan slo file: %w", err)
+		}
+	}
+	labels := sloPercentileLabels(quantiles)
+	checks := make([]sloCheck, 0, len(all))
+	for _, expr := range all {
+		if strings.TrimSpace(expr) == "" {
+			continue
+		}
+		check, err := parseSLOCheck(expr, labels)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+// lookupStatsMetric достает значение метрики из stats-файла.
+func lookupStatsMetric(stats measureStatsFile, metric string) (float64, bool) {
+	switch metric {
+	case "total_read":
+		return float64(stats.TotalRead), true
+	case "ok":
+		return float64(stats.OK), true
+	case "bad":
+		return float64(stats.Bad), true
+	case "lost":
+		return float64(stats.Lost), true
+	case "lost_ratio":
+		return stats.LostRatio, true
+	case "duration_sec":
+		return stats.DurationSec, true
+	case "ok_throughput_msg_s":
+		return stats.OKThroughputMsgS, true
+	case "ok_throughput_bytes_s":
+		return stats.OKThroughputBytesS, true
+	}
+	dist, stat, _ := strings.Cut(metric, ".")
+	var d *distributionStats
+	switch dist {
+	case "serve_us":
+		d = stats.ServeUs
+	case "latency_us":
+		d = stats.LatencyUs
+	case "process_us":
+		d = stats.ProcessUs
+	}
+	return lookupDistribution(d, stat)
+}
+
+// lookupDistribution достает статистику распределения: count, min, max, mean, stddev, pNN.
+func lookupDistribution(d *distributionStats, stat string) (float64, bool) {
+	if d == nil {
+		return 0, false
+	}
+	switch stat {
+	case "count":
+		return float64(d.Count), true
+	case "min":
+		return float64(d.Min), true
+	case "max":
+		return float64(d.Max), true
+	case "mean":
+		return d.Mean, true
+	case "stddev":
+		return d.StdDev, true
+	case "p50":
+		return float64(d.P50), true
+	case "p90":
+		return float64(d.P90), true
+	case "p95":
+		return float64(d.P95), true
+	case "p99":
+		return float64(d.P99), true
+	}
+	if v, ok := d.Percentiles[stat]; ok {
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func compareSLO(value float64, op string, threshold float64) bool {
+	switch op {
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "==":
+		return value == threshold
+	case "!=":
+		return value != threshold
+	default:
+		return false
+	}
+}
+
+// evaluateSLO проверяет выражения; отсутствующая метрика считается провалом.
+func evaluateSLO(checks []sloCheck, stats measureStatsFile) []sloResult {
+	results := make([]sloResult, 0, len(checks))
+	for _, check := range checks {
+		value, found := lookupStatsMetric(stats, check.Metric)
+		results = append(results, sloResult{
+			sloCheck: check,
+			Value:    value,
+			Found:    found,
+			Pass:     found && compareSLO(value, check.Op, check.Threshold),
+		})
+	}
+	return results
+}
+
+// formatSLOTable формирует таблицу pass/fail для вывода.
+func formatSLOTable(results []sloResult) string {
+	width := len("check")
+	for _, r := range results {
+		width = max(width, len(r.Expr))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-6s %-*s %s\n", "status", width, "check", "value")
+	for _, r := range results {
+		status := "PASS"
+		if !r.Pass {
+			status = "FAIL"
+		}
+		value := "n/a"
+		if r.Found {
+			value = strconv.FormatFloat(r.Value, 'f', -1, 64)
+		}
+		fmt.Fprintf(&b, "%-6s %-*s %s\n", status, width, r.Expr, value)
+	}
+	return b.String()
+}
+
+// sloViolation возвращает ошибку нарушения SLO или nil.
+func sloViolation(results []sloResult) error {
+	failed := 0
+	for _, r := range results {
+		if !r.Pass {
+			failed++
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+	return &SLOViolationError{Failed: failed, Total: len(results)}
+}
@@ -0,0 +1,268 @@
+package propher
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// stageSource и stageRead - неявные первая и последняя точки конвейера.
+	stageSource = "source"
+	stageRead   = "read"
+	// stageTailQuantile - сквозная задержка, с которой запись считается хвостовой.
+	stageTailQuantile = 0.99
+	// stageTailRatio - шаг логарифмических ячеек сквозной задержки для хвоста.
+	stageTailRatio = 1.02
+)
+
+// stageField - поле метки времени одного сервиса конвейера.
+type stageField struct {
+	Field string
+	Unit  string
+}
+
+// parseStages разбирает упорядоченный список вида "ingest_ts:ms,enrich_ts,sent_epoch:us".
+func parseStages(s, defaultUnit string) ([]stageField, error) {
+	var out []stageField
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		field, unit, ok := strings.Cut(part, ":")
+		if !ok {
+			unit = defaultUnit
+		}
+		unit = normalizeUnit(unit)
+		if !validReadUnit(unit) {
+			return nil, fmt.Errorf("unsupported unit %q for stage %q", unit, field)
+		}
+		if field == "" || field == stageSource || field == stageRead {
+			return nil, fmt.Errorf("bad stage field %q", part)
+		}
+		if err := validateFieldPaths(field); err != nil {
+			return nil, err
+		}
+		if seen[field] {
+			return nil, fmt.Errorf("duplicate stage %q", field)
+		}
+		seen[field] = true
+		out = append(out, stageField{Field: field, Unit: unit})
+	}
+	return out, nil
+}
+
+// stageHops возвращает имена участков: участок назван по точке, которой заканчивается.
+func stageHops(stages []stageField) (from, to []string) {
+	prev := stageSource
+	for _, s := range stages {
+		from = append(from, prev)
+		to = append(to, s.Field)
+		prev = s.Field
+	}
+	return append(from, prev), append(to, stageRead)
+}
+
+// fillStages считает длительности участков от отправки в источнике до чтения из очереди.
+// Участок без одной из меток пропускается; отрицательный участок отмечает нарушение порядка.
+func fillStages(rec *Record, obj map[string]any, stages []stageField, readUs int64) {
+	if len(stages) == 0 || rec.SourceSentUs == nil {
+		return
+	}
+	rec.HopsUs = make(map[string]int64, len(stages)+1)
+	prev := rec.SourceSentUs
+	add := func(name string, at *int64) {
+		if prev != nil && at != nil {
+			d := *at - *prev
+			rec.HopsUs[name] = d
+			if d < 0 {
+				rec.StagesOutOfOrder = true
+			}
+		}
+		prev = at
+	}
+	for _, s := range stages {
+		var at *int64
+		if v, ok := lookupField(obj, s.Field); ok && v != nil {
+			at, _ = parseFieldToEpoch(v, s.Unit)
+		}
+		add(s.Field, at)
+	}
+	add(stageRead, &readUs)
+}
+
+// hopStats - статистика одного участка конвейера.
+type hopStats struct {
+	Hop        string `json:"hop"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Missing    int    `json:"missing"`
+	OutOfOrder int    `json:"out_of_order"`
+	// Us - длительность участка по записям с правильным порядком меток.
+	Us *distributionStats `json:"us,omitempty"`
+	// TailMeanUs и TailShare - средняя длительность и доля участка в сквозной задержке хвостовых записей.
+	TailMeanUs float64 `json:"tail_mean_us"`
+	TailShare  float64 `json:"tail_share"`
+}
+
+// stagesSummary - разбивка сквозной задержки по участкам конвейера.
+type stagesSummary struct {
+	Hops              []hopStats `json:"hops"`
+	OutOfOrderRecords int        `json:"out_of_order_records"`
+	// TailFromUs - порог сквозной задержки (p99), начиная с которого запись в хвосте.
+	TailFromUs  int64  `json:"tail_from_us"`
+	TailRecords int    `json:"tail_records"`
+	TailStage   string `json:"tail_stage,omitempty"`
+}
+
+// stageTailBucket - суммы участков записей с близкой сквозной задержкой.
+type stageTailBucket struct {
+	count int
+	sums  []int64
+}
+
+// stageAggregator накапливает длительности участков успешных записей.
+type stageAggregator struct {
+	from, to   []string
+	hists      []*hdrHistogram
+	missing    []int
+	outOfOrder []int
+	disorder   int
+	e2e        *hdrHistogram
+	tail       map[int]*stageTailBucket
+}
+
+// newStageAggregator возвращает nil, если стадии не заданы.
+func newStageAggregator(stages []stageField, digits int) *stageAggregator {
+	if len(stages) == 0 {
+		return nil
+	}
+	from, to := stageHops(stages)
+	a := &stageAggregator{
+		from:       from,
+		to:         to,
+		missing:    make([]int, len(to)),
+		outOfOrder: make([]int, len(to)),
+		e2e:        newHDRHistogram(digits),
+		tail:       make(map[int]*stageTailBucket),
+	}
+	for range to {
+		a.hists = append(a.hists, newHDRHistogram(digits))
+	}
+	return a
+}
+
+func stageTailKey(us int64) int {
+	return int(math.Log(float64(max(us, 1))) / math.Log(stageTailRatio))
+}
+
+func (a *stageAggregator) observe(rec Record) {
+	if !rec.OK {
+		return
+	}
+	if rec.StagesOutOfOrder {
+		a.disorder++
+	}
+	complete := true
+	hops := make([]int64, len(a.to))
+	for i, name := range a.to {
+		d, ok := rec.HopsUs[name]
+		switch {
+		case !ok:
+			a.missing[i]++
+			complete = false
+		case d < 0:
+			a.outOfOrder[i]++
+			complete = false
+		default:
+			a.hists[i].Record(d)
+			hops[i] = d
+		}
+	}
+	if !complete {
+		return
+	}
+	// Сумма участков - сквозная задержка от источника до чтения.
+	var e2e int64
+	for _, d := range hops {
+		e2e += d
+	}
+	a.e2e.Record(e2e)
+	key := stageTailKey(e2e)
+	b, ok := a.tail[key]
+	if !ok {
+		b = &stageTailBucket{sums: make([]int64, len(a.to))}
+		a.tail[key] = b
+	}
+	b.count++
+	for i, d := range hops {
+		b.sums[i] += d
+	}
+}
+
+// summary собирает статистику участков и определяет участок с наибольшим вкладом в хвост.
+func (a *stageAggregator) summary(quantiles []float64) *stagesSummary {
+	out := &stagesSummary{OutOfOrderRecords: a.disorder}
+	tailSums := make([]int64, len(a.to))
+	var tailTotal int64
+	if a.e2e.Count() > 0 {
+		out.TailFromUs = a.e2e.ValueAtQuantile(stageTailQuantile)
+		fromKey := stageTailKey(out.TailFromUs)
+		for key, b := range a.tail {
+			if key < fromKey {
+				continue
+			}
+			out.TailRecords += b.count
+			for i, s := range b.sums {
+				tailSums[i] += s
+				tailTotal += s
+			}
+		}
+	}
+	var top int64 = -1
+	for i := range a.to {
+		st := hopStats{
+			Hop:        a.from[i] + "->" + a.to[i],
+			From:       a.from[i],
+			To:         a.to[i],
+			Missing:    a.missing[i],
+			OutOfOrder: a.outOfOrder[i],
+		}
+		if a.hists[i].Count() > 0 {
+			st.Us = summarizeHistogram(a.hists[i], quantiles, false)
+		}
+		if out.TailRecords > 0 {
+			st.TailMeanUs = float64(tailSums[i]) / float64(out.TailRecords)
+		}
+		if tailTotal > 0 {
+			st.TailShare = float64(tailSums[i]) / float64(tailTotal)
+		}
+		if out.TailRecords > 0 && tailSums[i] > top {
+			top = tailSums[i]
+			out.TailStage = st.Hop
+		}
+		out.Hops = append(out.Hops, st)
+	}
+	return out
+}
+
+// logStages печатает строку [STAGE] на каждый участок и итог по хвосту.
+func logStages(s *stagesSummary) {
+	if s == nil {
+		return
+	}
+	for _, h := range s.Hops {
+		p50, p99 := "n/a", "n/a"
+		if h.Us != nil {
+			p50 = strconv.FormatInt(h.Us.P50, 10)
+			p99 = strconv.FormatInt(h.Us.P99, 10)
+		}
+		measureLogger.Printf("[STAGE] hop=%s p50=%s p99=%s missing=%d out_of_order=%d tail_mean_us=%.0f tail_share=%.3f",
+			h.Hop, p50, p99, h.Missing, h.OutOfOrder, h.TailMeanUs, h.TailShare)
+	}
+	measureLogger.Printf("[STAGE] tail_stage=%s tail_from_us=%d tail_records=%d out_of_order_records=%d",
+		s.TailStage, s.TailFromUs, s.TailRecords, s.OutOfOrderRecords)
+}
@@ -0,0 +1,166 @@
+package propher
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Режимы переписывания меток времени.
+const (
+	rewriteSame      = "same"
+	rewriteIncrement = "increment"
+	// rewriteShift - сдвиг на ту же величину, на которую сдвинуто поле -sent-field сообщения.
+	rewriteShift = "shift"
+)
+
+// timeRule - дополнительное правило переписывания метки времени.
+type timeRule struct {
+	Field  string
+	Mode   string
+	Format string
+
+	format epochFormat
+	keep   bool
+	loc    *time.Location
+
+	rewritten int64
+	skipped   int64
+}
+
+// timeRuleOption - начало опции правила; запятые внутри значений (layout:Jan 2, 2006) не делят правило.
+var timeRuleOption = regexp.MustCompile(`,\s*[A-Za-z_]+\s*=`)
+
+// parseTimeRule разбирает правило вида "expires_at[,format=auto][,mode=shift]".
+func parseTimeRule(spec string, loc *time.Location) (*timeRule, error) {
+	var parts []string
+	prev := 0
+	for _, m := range timeRuleOption.FindAllStringIndex(spec, -1) {
+		parts = append(parts, spec[prev:m[0]])
+		prev = m[0] + 1
+	}
+	parts = append(parts, spec[prev:])
+	r := &timeRule{Field: strings.TrimSpace(parts[0]), Mode: rewriteShift, Format: "auto", loc: loc}
+	if r.Field == "" {
+		return nil, fmt.Errorf("rewrite %q: field is required", spec)
+	}
+	if _, opt, ok := strings.Cut(r.Field, ","); ok {
+		return nil, fmt.Errorf("rewrite %q: bad option %q (want key=value)", spec, opt)
+	}
+	for _, part := range parts[1:] {
+		k, v, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("rewrite %q: bad option %q (want key=value)", spec, part)
+		}
+		switch strings.TrimSpace(k) {
+		case "format":
+			r.Format = strings.TrimSpace(v)
+		case "mode":
+			r.Mode = strings.TrimSpace(v)
+		default:
+			return nil, fmt.Errorf("rewrite %q: unknown option %q (want format or mode)", spec, k)
+		}
+	}
+	switch r.Mode {
+	case rewriteSame, rewriteIncrement, rewriteShift:
+	default:
+		return nil, fmt.Errorf("rewrite %q: mode must be same, increment or shift", spec)
+	}
+	var err error
+	if r.format, r.keep, err = parseEpochFormat(r.Format, loc); err != nil {
+		return nil, fmt.Errorf("rewrite %q: %w", spec, err)
+	}
+	if err := validateFieldPaths(r.Field); err != nil {
+		return nil, fmt.Errorf("rewrite %q: %w", spec, err)
+	}
+	return r, nil
+}
+
+// parseTimeRules разбирает правила и проверяет, что каждое поле переписывается одним правилом.
+// Поля сравниваются по шагам пути: meta.sent и /meta/sent - одно поле.
+func parseTimeRules(specs []string, loc *time.Location, reserved ...string) ([]*timeRule, error) {
+	var seen [][]pathStep
+	for _, f := range reserved {
+		if f == "" {
+			continue
+		}
+		steps, err := parseFieldPath(f)
+		if err != nil {
+			return nil, err
+		}
+		seen = append(seen, steps)
+	}
+	var rules []*timeRule
+	for _, spec := range specs {
+		r, err := parseTimeRule(spec, loc)
+		if err != nil {
+			return nil, err
+		}
+		steps, err := parseFieldPath(r.Field)
+		if err != nil {
+			return nil, fmt.Errorf("rewrite %q: %w", spec, err)
+		}
+		for _, s := range seen {
+			if samePath(s, steps) {
+				return nil, fmt.Errorf("rewrite %q: field %s is already rewritten", spec, r.Field)
+			}
+		}
+		seen = append(seen, steps)
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// parse читает метку из JSON-значения в формате f.
+func (f epochFormat) parse(raw []byte) (time.Time, bool) {
+	s := jsonRawString(raw)
+	if s == "" {
+		return time.Time{}, false
+	}
+	if f.layout != "" {
+		t, err := time.ParseInLocation(f.layout, s, f.loc)
+		return t, err == nil
+	}
+	nanos, ok := unitNanos[f.unit]
+	if !ok {
+		return time.Time{}, false
+	}
+	ns, ok := decimalToNanos(s, nanos)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, ns), true
+}
+
+// apply переписывает поле правила в doc. src - исходное сообщение, из которого читается
+// прежнее значение; same и inc - метки режимов same и increment, delta - сдвиг -sent-field.
+// Для shift поле без распознаваемого значения или сообщение без delta остаются как есть.
+func (r *timeRule) apply(src, doc []byte, same, inc time.Time, delta time.Duration, hasDelta bool) ([]byte, error) {
+	raw, found := getJSONField(src, r.Field)
+	f := r.format
+	if r.keep {
+		f = detectEpochFormat(raw, r.format, r.loc)
+	}
+	var at time.Time
+	switch r.Mode {
+	case rewriteSame:
+		at = same
+	case rewriteIncrement:
+		at = inc
+	case rewriteShift:
+		// Прежнее значение читается в своем формате, даже если пишется в другом.
+		prev, ok := detectEpochFormat(raw, f, r.loc).parse(raw)
+		if !found || !ok || !hasDelta {
+			r.skipped++
+			return doc, nil
+		}
+		at = prev.Add(delta)
+	}
+	out, err := setJSONField(doc, r.Field, f.appendJSON(nil, at))
+	if err != nil {
+		return nil, err
+	}
+	r.rewritten++
+	return out, nil
+}
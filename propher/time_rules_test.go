@@ -0,0 +1,54 @@
+package propher
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeRule(t *testing.T) {
+	tests := []struct {
+		spec                string
+		field, format, mode string
+	}{
+		{"expires_at", "expires_at", "auto", rewriteShift},
+		{"expires_at,mode=same", "expires_at", "auto", rewriteSame},
+		{"queued_at, format=rfc3339 , mode=increment", "queued_at", "rfc3339", rewriteIncrement},
+		{"meta.sent,format=layout:Jan 2, 2006 15:04,mode=same", "meta.sent", "layout:Jan 2, 2006 15:04", rewriteSame},
+		{"meta.sent,mode=shift,format=layout:Mon, 02 Jan 2006", "meta.sent", "layout:Mon, 02 Jan 2006", rewriteShift},
+	}
+	for _, tt := range tests {
+		r, err := parseTimeRule(tt.spec, time.UTC)
+		if err != nil {
+			t.Errorf("%q: %v", tt.spec, err)
+			continue
+		}
+		if r.Field != tt.field || r.Format != tt.format || r.Mode != tt.mode {
+			t.Errorf("%q = field %q format %q mode %q", tt.spec, r.Field, r.Format, r.Mode)
+		}
+	}
+	for _, spec := range []string{"", ",mode=same", "a,mode=later", "a,speed=1", "a,format", "a,format=parsec", "a..b"} {
+		if _, err := parseTimeRule(spec, time.UTC); err == nil {
+			t.Errorf("%q: want error", spec)
+		}
+	}
+}
+
+func TestParseTimeRulesReservedPaths(t *testing.T) {
+	reserved := []string{"meta.sent", "message_id", "", "items[0].trace"}
+	for _, specs := range [][]string{
+		{"/meta/sent"},
+		{"meta.sent,format=rfc3339"},
+		{"/message_id"},
+		{"/items/0/trace"},
+		{"a.b", "/a/b"},
+		{"created_at", "created_at,mode=same"},
+	} {
+		if _, err := parseTimeRules(specs, time.UTC, reserved...); err == nil {
+			t.Errorf("%q: want already rewritten error", specs)
+		}
+	}
+	rules, err := parseTimeRules([]string{"/meta/recv", "meta.sent_at", "created_at"}, time.UTC, reserved...)
+	if err != nil || len(rules) != 3 {
+		t.Errorf("distinct fields: %d rules, %v", len(rules), err)
+	}
+}
@@ -0,0 +1,239 @@
+package propher
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Форматы меток времени: epoch-числа в s/ms/us/ns, строки RFC3339 и раскладки Go.
+
+// timeLayoutPrefix - единица вида "layout:2006-01-02 15:04:05.000" задает раскладку Go.
+const timeLayoutPrefix = "layout:"
+
+// unitNanos - наносекунд в единице epoch.
+var unitNanos = map[string]int64{"s": 1e9, "ms": 1e6, "us": 1e3, "ns": 1}
+
+func isEpochUnit(u string) bool {
+	_, ok := unitNanos[u]
+	return ok
+}
+
+// validReadUnit - единица чтения метки: auto, s, ms, us, ns или layout:<раскладка>.
+func validReadUnit(unit string) bool {
+	u := normalizeUnit(unit)
+	return u == "auto" || isEpochUnit(u) || len(u) > len(timeLayoutPrefix) && strings.HasPrefix(u, timeLayoutPrefix)
+}
+
+// epochUnitByMagnitude определяет единицу epoch по порядку величины.
+func epochUnitByMagnitude(abs int64) (string, bool) {
+	switch {
+	case abs >= 1e18:
+		return "ns", true
+	case abs >= 1e15:
+		return "us", true
+	case abs >= 1e12:
+		return "ms", true
+	case abs >= 1e9:
+		return "s", true
+	}
+	return "", false
+}
+
+// isNumericString - строка из цифр с необязательной дробной частью.
+func isNumericString(s string) bool {
+	digits, dot := 0, false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] >= '0' && s[i] <= '9':
+			digits++
+		case s[i] == '.' && !dot && digits > 0:
+			dot = true
+		default:
+			return false
+		}
+	}
+	return digits > 0 && s[len(s)-1] != '.'
+}
+
+// decimalToNanos переводит десятичную запись "целое.дробь" в единице с nanos наносекунд
+// в наносекунды без потерь float64.
+func decimalToNanos(s string, nanos int64) (int64, bool) {
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if !isNumericString(intPart) || strings.Trim(fracPart, "0123456789") != "" {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(intPart, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	fracPart = (fracPart + "000000000")[:9]
+	frac, _ := strconv.ParseInt(fracPart, 10, 64)
+	return n*nanos + frac*nanos/1e9, true
+}
+
+// detectTimeLayout подбирает раскладку ISO-подобной строки: разделитель T или пробел,
+// число знаков дробной части и вид смещения сохраняются, чтобы писать в том же формате.
+// Строка без смещения читается в loc.
+func detectTimeLayout(s string, loc *time.Location) (string, time.Time, bool) {
+	if len(s) < 19 || s[4] != '-' || s[7] != '-' || (s[10] != 'T' && s[10] != ' ') || s[13] != ':' || s[16] != ':' {
+		return "", time.Time{}, false
+	}
+	layout := "2006-01-02" + s[10:11] + "15:04:05"
+	i := 19
+	if i < len(s) && s[i] == '.' {
+		j := i + 1
+		for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+			j++
+		}
+		layout += "." + strings.Repeat("0", j-i-1)
+		i = j
+	}
+	switch zone := s[i:]; {
+	case zone == "":
+	case zone == "Z":
+		layout += "Z07:00"
+	case len(zone) == 6 && zone[3] == ':':
+		layout += "-07:00"
+	case len(zone) == 5:
+		layout += "-0700"
+	default:
+		return "", time.Time{}, false
+	}
+	t, err := time.ParseInLocation(layout, s, loc)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return layout, t, true
+}
+
+// parseTimeString разбирает строковую метку: по раскладке из unit или ISO/RFC3339 с любым смещением.
+func parseTimeString(s, unit string) (time.Time, error) {
+	if layout, ok := strings.CutPrefix(normalizeUnit(unit), timeLayoutPrefix); ok {
+		return time.ParseInLocation(layout, s, time.UTC)
+	}
+	if _, t, ok := detectTimeLayout(s, time.UTC); ok {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// parseTimeZone разбирает зону для записи строк: UTC, Local, смещение (+03:00, -0530) или имя IANA.
+func parseTimeZone(tz string) (*time.Location, error) {
+	switch tz = strings.TrimSpace(tz); {
+	case tz == "" || strings.EqualFold(tz, "UTC"):
+		return time.UTC, nil
+	case strings.EqualFold(tz, "Local"):
+		return time.Local, nil
+	case tz[0] == '+' || tz[0] == '-':
+		for _, layout := range []string{"-07:00", "-0700", "-07"} {
+			if t, err := time.Parse(layout, tz); err == nil {
+				_, offset := t.Zone()
+				return time.FixedZone(tz, offset), nil
+			}
+		}
+		return nil, fmt.Errorf("bad time zone offset %q", tz)
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("time zone %q: %w", tz, err)
+	}
+	return loc, nil
+}
+
+// epochFormat - формат записи метки времени.
+type epochFormat struct {
+	// unit - единица epoch-числа: s, ms, us, ns.
+	unit string
+	// quoted - число записывается строкой.
+	quoted bool
+	// frac - знаков дробной части секунд (для unit s).
+	frac int
+	// layout и loc - строка по раскладке Go в зоне loc вместо числа.
+	layout string
+	loc    *time.Location
+}
+
+// parseEpochFormat разбирает -epoch-unit; auto означает сохранять формат поля (keep),
+// а при отсутствии или нераспознанном значении писать epoch ms.
+func parseEpochFormat(unit string, loc *time.Location) (f epochFormat, keep bool, err error) {
+	u := strings.TrimSpace(unit)
+	switch {
+	case isEpochUnit(strings.ToLower(u)):
+		return epochFormat{unit: strings.ToLower(u)}, false, nil
+	case strings.EqualFold(u, "auto"):
+		return epochFormat{unit: "ms"}, true, nil
+	case strings.EqualFold(u, "rfc3339"):
+		return epochFormat{layout: time.RFC3339Nano, loc: loc}, false, nil
+	case len(u) > len(timeLayoutPrefix) && strings.HasPrefix(u, timeLayoutPrefix):
+		return epochFormat{layout: u[len(timeLayoutPrefix):], loc: loc}, false, nil
+	}
+	return f, false, fmt.Errorf("epoch-unit must be s, ms, us, ns, rfc3339, layout:<go layout> or auto")
+}
+
+// numericEpochFormat определяет формат числовой метки по величине; дробное число - секунды.
+func numericEpochFormat(s string, quoted bool) (epochFormat, bool) {
+	intPart, fracPart, hasFrac := strings.Cut(s, ".")
+	n, err := strconv.ParseInt(intPart, 10, 64)
+	if err != nil {
+		return epochFormat{}, false
+	}
+	if hasFrac {
+		if n < 1e9 || n >= 1e12 {
+			return epochFormat{}, false
+		}
+		return epochFormat{unit: "s", quoted: quoted, frac: len(fracPart)}, true
+	}
+	unit, ok := epochUnitByMagnitude(n)
+	return epochFormat{unit: unit, quoted: quoted}, ok
+}
+
+// detectEpochFormat определяет формат текущего значения поля; fallback - если не распознан.
+func detectEpochFormat(raw []byte, fallback epochFormat, loc *time.Location) epochFormat {
+	if len(raw) == 0 {
+		return fallback
+	}
+	if raw[0] != '"' {
+		if f, ok := numericEpochFormat(string(raw), false); ok {
+			return f
+		}
+		return fallback
+	}
+	s := jsonRawString(raw)
+	if isNumericString(s) {
+		if f, ok := numericEpochFormat(s, true); ok {
+			return f
+		}
+		return fallback
+	}
+	if layout, t, ok := detectTimeLayout(s, loc); ok {
+		return epochFormat{layout: layout, loc: t.Location()}
+	}
+	return fallback
+}
+
+// appendJSON дописывает метку t в JSON-кодировке.
+func (f epochFormat) appendJSON(dst []byte, t time.Time) []byte {
+	if f.layout != "" {
+		return appendJSONString(dst, t.In(f.loc).Format(f.layout))
+	}
+	if f.quoted {
+		dst = append(dst, '"')
+	}
+	if f.frac > 0 {
+		ns := t.UnixNano()
+		dst = strconv.AppendInt(dst, ns/1e9, 10)
+		dst = append(dst, '.')
+		dst = append(dst, fmt.Sprintf("%09d", ns%1e9)[:min(f.frac, 9)]...)
+		for i := 9; i < f.frac; i++ {
+			dst = append(dst, '0')
+		}
+	} else {
+		dst = strconv.AppendInt(dst, t.UnixNano()/unitNanos[f.unit], 10)
+	}
+	if f.quoted {
+		dst = append(dst, '"')
+	}
+	return dst
+}
@@ -0,0 +1,230 @@
+package propher
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// measureSeriesRow - строка временного ряда режима measure-list-latency.
+type measureSeriesRow struct {
+	StartUs     int64              `json:"start_us"`
+	IntervalSec float64            `json:"interval_sec"`
+	Sent        int                `json:"sent"`
+	SentMsgS    float64            `json:"sent_msg_s"`
+	Received    int                `json:"received"`
+	OK          int                `json:"ok"`
+	Bad         int                `json:"bad"`
+	RecvMsgS    float64            `json:"recv_msg_s"`
+	OKMsgS      float64            `json:"ok_msg_s"`
+	ServeUs     *distributionStats `json:"serve_us,omitempty"`
+	LatencyUs   *distributionStats `json:"latency_us,omitempty"`
+}
+
+// sendSeriesRow - строка временного ряда режима load-dump-and-rewrite.
+type sendSeriesRow struct {
+	StartUs     int64   `json:"start_us"`
+	IntervalSec float64 `json:"interval_sec"`
+	Sent        int     `json:"sent"`
+	SentMsgS    float64 `json:"sent_msg_s"`
+}
+
+// seriesFile - JSONL-файл временного ряда.
+type seriesFile struct {
+	f      *os.File
+	w      *bufio.Writer
+	closed bool
+}
+
+func createSeriesFile(path string) (*seriesFile, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create timeseries file: %w", err)
+	}
+	return &seriesFile{f: f, w: bufio.NewWriterSize(f, 64*1024)}, nil
+}
+
+func (s *seriesFile) write(row any) {
+	b, _ := json.Marshal(row)
+	s.w.Write(b)
+	s.w.WriteByte('\n')
+}
+
+// Close идемпотентен, чтобы сочетаться с defer.
+func (s *seriesFile) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if err := s.w.Flush(); err != nil {
+		s.f.Close()
+		return fmt.Errorf("flush timeseries file: %w", err)
+	}
+	return s.f.Close()
+}
+
+// measureSeries накапливает текущий интервал и пишет завершенные.
+// Не потокобезопасен: вызывается под мьютексом measureCollector.
+type measureSeries struct {
+	out        *seriesFile
+	intervalUs int64
+	digits     int
+	// sentTimes - отсортированные sent-метки источника для подсчета отправок.
+	sentTimes []int64
+
+	startUs   int64
+	received  int
+	okCount   int
+	badCount  int
+	serveHist *hdrHistogram
+	latHist   *hdrHistogram
+}
+
+func newMeasureSeries(out *seriesFile, intervalUs, startUs int64, digits int, sourceIndex map[string]sourceRecord) *measureSeries {
+	return &measureSeries{
+		out:        out,
+		intervalUs: intervalUs,
+		digits:     digits,
+		sentTimes:  sortedSentTimes(sourceIndex),
+		startUs:    startUs,
+		serveHist:  newHDRHistogram(digits),
+		latHist:    newHDRHistogram(digits),
+	}
+}
+
+// sortedSentTimes возвращает отсортированные sent-метки источника.
+func sortedSentTimes(sourceIndex map[string]sourceRecord) []int64 {
+	sentTimes := make([]int64, 0, len(sourceIndex))
+	for _, rec := range sourceIndex {
+		sentTimes = append(sentTimes, rec.SentUs)
+	}
+	sort.Slice(sentTimes, func(i, j int) bool { return sentTimes[i] < sentTimes[j] })
+	return sentTimes
+}
+
+// countSentBetween возвращает число отправок источника в [from, to).
+func countSentBetween(sentTimes []int64, from, to int64) int {
+	lo := sort.Search(len(sentTimes), func(i int) bool { return sentTimes[i] >= from })
+	hi := sort.Search(len(sentTimes), func(i int) bool { return sentTimes[i] >= to })
+	return hi - lo
+}
+
+// advance закрывает все интервалы, закончившиеся к nowUs.
+func (s *measureSeries) advance(nowUs int64) {
+	for nowUs >= s.startUs+s.intervalUs {
+		s.flush(s.startUs + s.intervalUs)
+	}
+}
+
+func (s *measureSeries) observe(rec Record, readUs int64) {
+	s.advance(readUs)
+	s.received++
+	if rec.OK {
+		s.okCount++
+		s.serveHist.Record(*rec.ServeUs)
+		s.latHist.Record(*rec.LatencyUs)
+	} else {
+		s.badCount++
+	}
+}
+
+// flush пишет строку за [startUs, endUs) и начинает следующий интервал.
+func (s *measureSeries) flush(endUs int64) {
+	durS := float64(endUs-s.startUs) / 1_000_000.0
+	if durS <= 0 {
+		durS = 1e-9
+	}
+	sent := countSentBetween(s.sentTimes, s.startUs, endUs)
+	row := &measureSeriesRow{
+		StartUs:     s.startUs,
+		IntervalSec: durS,
+		Sent:        sent,
+		SentMsgS:    float64(sent) / durS,
+		Received:    s.received,
+		OK:          s.okCount,
+		Bad:         s.badCount,
+		RecvMsgS:    float64(s.received) / durS,
+		OKMsgS:      float64(s.okCount) / durS,
+		ServeUs:     summarizeHistogram(s.serveHist, nil, false),
+		LatencyUs:   summarizeHistogram(s.latHist, nil, false),
+	}
+	if s.out != nil {
+		s.out.write(row)
+	}
+
+	s.startUs = endUs
+	s.received, s.okCount, s.badCount = 0, 0, 0
+	s.serveHist = newHDRHistogram(s.digits)
+	s.latHist = newHDRHistogram(s.digits)
+}
+
+// finish закрывает последний (возможно неполный) интервал.
+func (s *measureSeries) finish(nowUs int64) {
+	s.advance(nowUs)
+	if nowUs > s.startUs {
+		s.flush(nowUs)
+	}
+}
+
+// sendSeries считает отправки по интервалам в режиме загрузки.
+type sendSeries struct {
+	out        *seriesFile
+	intervalUs int64
+	startUs    int64
+	sent       int
+}
+
+func newSendSeries(out *seriesFile, intervalUs, startUs int64) *sendSeries {
+	return &sendSeries{out: out, intervalUs: intervalUs, startUs: startUs}
+}
+
+func (s *sendSeries) advance(nowUs int64) {
+	for nowUs >= s.startUs+s.intervalUs {
+		s.flush(s.startUs + s.intervalUs)
+	}
+}
+
+func (s *sendSeries) observe(nowUs int64) {
+	s.advance(nowUs)
+	s.sent++
+}
+
+func (s *sendSeries) flush(endUs int64) {
+	durS := float64(endUs-s.startUs) / 1_000_000.0
+	if durS <= 0 {
+		durS = 1e-9
+	}
+	s.out.write(sendSeriesRow{
+		StartUs:     s.startUs,
+		IntervalSec: durS,
+		Sent:        s.sent,
+		SentMsgS:    float64(s.sent) / durS,
+	})
+	s.startUs = endUs
+	s.sent = 0
+}
+
+func (s *sendSeries) finish(nowUs int64) {
+	s.advance(nowUs)
+	if nowUs > s.startUs {
+		s.flush(nowUs)
+	}
+}
+
+// buildTimeseriesPath строит путь временного ряда рядом с основным файлом.
+func buildTimeseriesPath(base string) string {
+	trimmed := strings.TrimSpace(base)
+	if trimmed == "" {
+		return "latency.timeseries.jsonl"
+	}
+	if strings.HasSuffix(trimmed, ".jsonl") {
+		return strings.TrimSuffix(trimmed, ".jsonl") + ".timeseries.jsonl"
+	}
+	if strings.HasSuffix(trimmed, ".json") {
+		return strings.TrimSuffix(trimmed, ".json") + ".timeseries.jsonl"
+	}
+	return trimmed + ".timeseries.jsonl"
+}